@@ -1,23 +1,200 @@
 package config
 
 import (
+	"time"
+
 	"github.com/jinzhu/configor"
 )
 
 // Config - Application configuration
 type Config struct {
-	Log    string `yaml:"log" default:"" env:"LOG_PATH"`
-	Debug  bool   `yaml:"debug" default:"false" env:"DEBUG"`
-	MySQL struct {
-		Host          string `yaml:"host" default:"localhost" env:"MYSQL_HOST"`
-		User          string `yaml:"user" default:"root" env:"MYSQL_USER"`
-		Password      string `yaml:"password" default:"" env:"MYSQL_PASSWORD"`
-		Port          int    `yaml:"port" default:"3306" env:"MYSQL_PORT"`
-		Database      string `yaml:"database" default:"" env:"MYSQL_DATABASE"`
-		DSN           string `yaml:"dsn" default:"" env:"MYSQL_DSN"`
-		ReadOnly      bool   `yaml:"read_only" default:"false" env:"MYSQL_READ_ONLY"`
-		ExplainCheck  bool   `yaml:"explain_check" default:"false" env:"MYSQL_EXPLAIN_CHECK"`
-	} `yaml:"mysql"`
+	Log   string      `yaml:"log" default:"" env:"LOG_PATH"`
+	Debug bool        `yaml:"debug" default:"false" env:"DEBUG"`
+	MySQL MySQLConfig `yaml:"mysql"`
+	// Connections - Additional named connection profiles, selected by the `connection` tool parameter
+	Connections map[string]MySQLConfig `yaml:"connections"`
+	// DefaultConnection - Profile used when a tool call does not name one. Empty means the `mysql` section
+	DefaultConnection string `yaml:"default_connection" default:"" env:"MYSQL_DEFAULT_CONNECTION"`
+
+	Server struct {
+		Transport string `yaml:"transport" default:"stdio" env:"MCP_TRANSPORT"`
+		Addr      string `yaml:"addr" default:":8080" env:"MCP_ADDR"`
+		BasePath  string `yaml:"base_path" default:"/" env:"MCP_BASE_PATH"`
+		// TLS settings for the http transport. A client CA enables client-certificate verification
+		TLSCertFile     string `yaml:"tls_cert_file" default:"" env:"MCP_TLS_CERT_FILE"`
+		TLSKeyFile      string `yaml:"tls_key_file" default:"" env:"MCP_TLS_KEY_FILE"`
+		TLSClientCAFile string `yaml:"tls_client_ca_file" default:"" env:"MCP_TLS_CLIENT_CA_FILE"`
+		// AllowToolDSN - Accept the dsn tool parameter over the http transport. It is always accepted over stdio
+		AllowToolDSN bool `yaml:"allow_tool_dsn" default:"false" env:"MCP_ALLOW_TOOL_DSN"`
+	} `yaml:"server"`
+
+	Query struct {
+		// MaxRows - Rows scanned per read before the result is truncated. 0 means unlimited
+		MaxRows int `yaml:"max_rows" default:"1000" env:"MYSQL_MAX_ROWS"`
+		// MaxResultBytes - Size limit of the rendered tool output. 0 means unlimited
+		MaxResultBytes int `yaml:"max_result_bytes" default:"1048576" env:"MYSQL_MAX_RESULT_BYTES"`
+		// CursorIdleTimeout - How long a truncated result stays available to fetch_more without being read
+		CursorIdleTimeout time.Duration `yaml:"cursor_idle_timeout" default:"5m" env:"MYSQL_CURSOR_IDLE_TIMEOUT"`
+		// CursorMaxRows - Rows beyond the first page a truncated read keeps in memory for fetch_more. 0 means unlimited
+		CursorMaxRows int `yaml:"cursor_max_rows" default:"10000" env:"MYSQL_CURSOR_MAX_ROWS"`
+		// MaxOpenCursors - Open cursors across all clients. Each one holds its rows in memory
+		MaxOpenCursors int `yaml:"max_open_cursors" default:"16" env:"MYSQL_MAX_OPEN_CURSORS"`
+		// Format - Default output format of reads: csv, tsv, json, jsonl or markdown
+		Format string `yaml:"format" default:"csv" env:"MYSQL_OUTPUT_FORMAT"`
+		// NullValue - How NULL is written in the text formats. JSON formats use null
+		NullValue string `yaml:"null_value" default:"NULL" env:"MYSQL_NULL_VALUE"`
+		// BinaryEncoding - Encoding of BINARY, VARBINARY, BLOB and BIT values: hex or base64
+		BinaryEncoding string `yaml:"binary_encoding" default:"hex" env:"MYSQL_BINARY_ENCODING"`
+		// TimeZone - Time zone of the MySQL session and of rendered TIMESTAMP values. Local keeps the server defaults,
+		// other zones also change what NOW() and TIMESTAMP values mean for writes
+		TimeZone string `yaml:"time_zone" default:"Local" env:"MYSQL_TIME_ZONE"`
+		// Timeout - Default statement timeout. Statements still running are killed with KILL QUERY. 0 disables it
+		Timeout time.Duration `yaml:"timeout" default:"30s" env:"MYSQL_QUERY_TIMEOUT"`
+	} `yaml:"query"`
+
+	Transaction struct {
+		// IdleTimeout - Transactions without a statement for this long are rolled back
+		IdleTimeout time.Duration `yaml:"idle_timeout" default:"1m" env:"MYSQL_TRANSACTION_IDLE_TIMEOUT"`
+		// MaxOpen - Open transactions across all clients. Each one holds a database connection
+		MaxOpen int `yaml:"max_open" default:"8" env:"MYSQL_MAX_OPEN_TRANSACTIONS"`
+	} `yaml:"transaction"`
+
+	Write struct {
+		// DryRun - Default of the dry_run parameter of write_query, update_query and delete_query
+		DryRun bool `yaml:"dry_run" default:"false" env:"MYSQL_DRY_RUN"`
+		// DryRunSampleRows - Matched rows a dry run shows before and after the statement. 0 shows none
+		DryRunSampleRows int `yaml:"dry_run_sample_rows" default:"10" env:"MYSQL_DRY_RUN_SAMPLE_ROWS"`
+		// RequireWhere - Reject UPDATE and DELETE without a WHERE clause or with one that matches every row
+		RequireWhere bool `yaml:"require_where" default:"true" env:"MYSQL_REQUIRE_WHERE"`
+		// MaxAffectedRows - Most rows a single UPDATE or DELETE may change. 0 means unlimited
+		MaxAffectedRows int `yaml:"max_affected_rows" default:"1000" env:"MYSQL_MAX_AFFECTED_ROWS"`
+		// ApprovalTimeout - How long the user has to approve a write on a require_approval connection. 0 waits indefinitely
+		ApprovalTimeout time.Duration `yaml:"approval_timeout" default:"5m" env:"MYSQL_APPROVAL_TIMEOUT"`
+	} `yaml:"write"`
+
+	DDL struct {
+		// AllowDrop - Let alter_table drop columns, indexes, keys, constraints and partitions
+		AllowDrop bool `yaml:"allow_drop" default:"false" env:"MYSQL_DDL_ALLOW_DROP"`
+		// AllowRename - Let alter_table rename the table, its columns and its indexes
+		AllowRename bool `yaml:"allow_rename" default:"false" env:"MYSQL_DDL_ALLOW_RENAME"`
+		// AllowModify - Let alter_table change existing columns, checks, table options and partitioning
+		AllowModify bool `yaml:"allow_modify" default:"false" env:"MYSQL_DDL_ALLOW_MODIFY"`
+	} `yaml:"ddl"`
+
+	Explain struct {
+		// Action - What a plan over a limit does on profiles with explain_check: reject the statement, or warn and run it
+		Action string `yaml:"action" default:"reject" env:"MYSQL_EXPLAIN_ACTION"`
+		// FullScanRows - Flag full table scans of tables estimated above this many rows. 0 disables it
+		FullScanRows int64 `yaml:"full_scan_rows" default:"0" env:"MYSQL_EXPLAIN_FULL_SCAN_ROWS"`
+		// MaxRowsExamined - Flag plans estimated to examine more rows than this in total. 0 disables it
+		MaxRowsExamined int64 `yaml:"max_rows_examined" default:"0" env:"MYSQL_EXPLAIN_MAX_ROWS_EXAMINED"`
+		// SortRows - Flag filesorts and temporary tables over more rows than this. 0 disables it
+		SortRows int64 `yaml:"sort_rows" default:"0" env:"MYSQL_EXPLAIN_SORT_ROWS"`
+		// MaxCost - Flag plans whose estimated query cost is above this. 0 disables it
+		MaxCost float64 `yaml:"max_cost" default:"0" env:"MYSQL_EXPLAIN_MAX_COST"`
+	} `yaml:"explain"`
+
+	Access struct {
+		// Rules - Allow and deny rules for databases, tables and columns. Deny rules win over allow rules
+		Rules []AccessRule `yaml:"rules"`
+	} `yaml:"access"`
+
+	Masking struct {
+		// Rules - Columns whose values are masked in query results. The first matching rule wins
+		Rules []MaskRule `yaml:"rules"`
+		// HashKey - Secret key of the hash mode, so pseudonyms cannot be reversed by hashing guessed values
+		HashKey string `yaml:"hash_key" default:"" env:"MYSQL_MASKING_HASH_KEY"`
+	} `yaml:"masking"`
+
+	Audit struct {
+		// Path - File that receives one JSON line per tool call. Empty disables the file
+		Path string `yaml:"path" default:"" env:"MCP_AUDIT_LOG_PATH"`
+		// MaxSizeMB - Size at which the audit file is rotated
+		MaxSizeMB int `yaml:"max_size_mb" default:"100" env:"MCP_AUDIT_MAX_SIZE_MB"`
+		// MaxBackups - Rotated audit files to keep. 0 keeps all
+		MaxBackups int `yaml:"max_backups" default:"10" env:"MCP_AUDIT_MAX_BACKUPS"`
+		// MaxAgeDays - Days to keep rotated audit files. 0 keeps them regardless of age
+		MaxAgeDays int `yaml:"max_age_days" default:"90" env:"MCP_AUDIT_MAX_AGE_DAYS"`
+		// Compress - Gzip rotated audit files
+		Compress bool `yaml:"compress" default:"false" env:"MCP_AUDIT_COMPRESS"`
+		// Table - MySQL table, optionally database.table, that also receives every record. Empty disables it
+		Table string `yaml:"table" default:"" env:"MCP_AUDIT_TABLE"`
+		// Connection - Profile the audit table is written to. Empty means the default connection
+		Connection string `yaml:"connection" default:"" env:"MCP_AUDIT_CONNECTION"`
+	} `yaml:"audit"`
+
+	RateLimit struct {
+		// Global - Limits shared by every tool call
+		Global RateLimitRule `yaml:"global"`
+		// Client - Limits applied to each authenticated client, or to each MCP session without authentication
+		Client RateLimitRule `yaml:"client"`
+		// Tools - Limits for each tool name, shared by all clients
+		Tools map[string]RateLimitRule `yaml:"tools"`
+	} `yaml:"rate_limit"`
+
+	Auth struct {
+		Tokens    []AuthToken `yaml:"tokens"`
+		TokenFile string      `yaml:"token_file" default:"" env:"MCP_AUTH_TOKEN_FILE"`
+		// Roles - Tool name patterns each role may call, e.g. reader: ["list_*", "read_query"]
+		Roles map[string][]string `yaml:"roles"`
+		// ClientCertRoles - Role for each verified client certificate, keyed by subject common name
+		ClientCertRoles map[string]string `yaml:"client_cert_roles"`
+		// AllowAnonymous - Serve the http transport without authentication when no token or certificate role is configured
+		AllowAnonymous bool `yaml:"allow_anonymous" default:"false" env:"MCP_AUTH_ALLOW_ANONYMOUS"`
+	} `yaml:"auth"`
+}
+
+// AuthToken - A static bearer token for the http transport
+type AuthToken struct {
+	Name  string `yaml:"name"`
+	Token string `yaml:"token"`
+	Role  string `yaml:"role"`
+}
+
+// AccessRule - Glob patterns of the objects a rule applies to. An empty pattern matches everything
+type AccessRule struct {
+	// Action - allow or deny
+	Action     string `yaml:"action"`
+	Connection string `yaml:"connection"`
+	Database   string `yaml:"database"`
+	Table      string `yaml:"table"`
+	Column     string `yaml:"column"`
+}
+
+// MaskRule - A column to mask and how. A rule with both patterns matches columns that match both
+type MaskRule struct {
+	// Column - Glob pattern of table.column, or of a column name in any table
+	Column string `yaml:"column"`
+	// ColumnRegex - Regular expression matched against column names, case-insensitively
+	ColumnRegex string `yaml:"column_regex"`
+	// Mode - redact, partial (keep the last 4 characters), hash or null
+	Mode string `yaml:"mode"`
+}
+
+// RateLimitRule - A token bucket and a cap on concurrent calls. Zero values disable each limit
+type RateLimitRule struct {
+	// RequestsPerMinute - Sustained rate of calls
+	RequestsPerMinute float64 `yaml:"requests_per_minute"`
+	// Burst - Calls allowed at once before the rate applies. 0 means a tenth of requests_per_minute, at least 1
+	Burst int `yaml:"burst"`
+	// MaxInFlight - Calls running at the same time
+	MaxInFlight int `yaml:"max_in_flight"`
+}
+
+// MySQLConfig - Connection settings for a single MySQL profile
+type MySQLConfig struct {
+	Host         string `yaml:"host" default:"localhost" env:"MYSQL_HOST"`
+	User         string `yaml:"user" default:"root" env:"MYSQL_USER"`
+	Password     string `yaml:"password" default:"" env:"MYSQL_PASSWORD"`
+	Port         int    `yaml:"port" default:"3306" env:"MYSQL_PORT"`
+	Database     string `yaml:"database" default:"" env:"MYSQL_DATABASE"`
+	DSN          string `yaml:"dsn" default:"" env:"MYSQL_DSN"`
+	ReadOnly     bool   `yaml:"read_only" default:"false" env:"MYSQL_READ_ONLY"`
+	ExplainCheck bool   `yaml:"explain_check" default:"false" env:"MYSQL_EXPLAIN_CHECK"`
+	// ReadOnlySession - Serve read tools from a separate pool whose sessions are read-only
+	ReadOnlySession bool `yaml:"read_only_session" default:"false" env:"MYSQL_READ_ONLY_SESSION"`
+	// RequireApproval - Ask the user to approve every write through MCP elicitation before it runs
+	RequireApproval bool `yaml:"require_approval" default:"false" env:"MYSQL_REQUIRE_APPROVAL"`
 }
 
 // LoadConfig - Load configuration file
@@ -39,6 +39,19 @@ func main() {
 					Value:   "config.yml",
 					Usage:   "path to the configuration file",
 				},
+				&cli.StringFlag{
+					Name:    "transport",
+					Aliases: []string{"t"},
+					Usage:   "transport to serve on: stdio or http (overrides configuration)",
+				},
+				&cli.StringFlag{
+					Name:  "addr",
+					Usage: "listen address for the http transport (overrides configuration)",
+				},
+				&cli.StringFlag{
+					Name:  "base-path",
+					Usage: "base path for the http transport endpoints (overrides configuration)",
+				},
 			},
 			Action: func(c *cli.Context) error {
 				configPath := c.String("config")
@@ -49,6 +62,17 @@ func main() {
 					return errors.Wrap(err, "failed to load configuration file")
 				}
 
+				// Command-line flags take precedence over the configuration file
+				if c.IsSet("transport") {
+					cfg.Server.Transport = c.String("transport")
+				}
+				if c.IsSet("addr") {
+					cfg.Server.Addr = c.String("addr")
+				}
+				if c.IsSet("base-path") {
+					cfg.Server.BasePath = c.String("base-path")
+				}
+
 				// Initialize logger
 				if err := logger.InitLogger(cfg.Debug, cfg.Log); err != nil {
 					return errors.Wrap(err, "failed to initialize logger")
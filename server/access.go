@@ -0,0 +1,474 @@
+package server
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+const (
+	AccessAllow = "allow"
+	AccessDeny  = "deny"
+)
+
+// AccessPolicy decides which databases, tables and columns the tools may see and use.
+// An object is accessible when no deny rule matches it and, if there are allow rules,
+// at least one allow rule matches it. A nil policy allows everything
+type AccessPolicy struct {
+	allow []config.AccessRule
+	deny  []config.AccessRule
+}
+
+// NewAccessPolicy - Create the access policy from the configured rules
+func NewAccessPolicy(cfg *config.Config) (*AccessPolicy, error) {
+	p := &AccessPolicy{}
+	for i, rule := range cfg.Access.Rules {
+		for _, pattern := range []string{rule.Connection, rule.Database, rule.Table, rule.Column} {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("access rule %d has an invalid pattern %q: %v", i, pattern, err)
+			}
+		}
+
+		switch strings.ToLower(rule.Action) {
+		case AccessAllow:
+			p.allow = append(p.allow, rule)
+		case AccessDeny:
+			p.deny = append(p.deny, rule)
+		default:
+			return nil, fmt.Errorf("access rule %d has unknown action %q, expected %s or %s", i, rule.Action, AccessAllow, AccessDeny)
+		}
+	}
+	return p, nil
+}
+
+// ForConnection returns the rules that apply to a connection profile
+func (p *AccessPolicy) ForConnection(name string) *AccessPolicy {
+	if p == nil {
+		return nil
+	}
+
+	filtered := &AccessPolicy{}
+	for _, rule := range p.allow {
+		if matchPattern(rule.Connection, name) {
+			filtered.allow = append(filtered.allow, rule)
+		}
+	}
+	for _, rule := range p.deny {
+		if matchPattern(rule.Connection, name) {
+			filtered.deny = append(filtered.deny, rule)
+		}
+	}
+	return filtered
+}
+
+// Enabled reports whether any rule applies
+func (p *AccessPolicy) Enabled() bool {
+	return p != nil && (len(p.allow) > 0 || len(p.deny) > 0)
+}
+
+// DatabaseAllowed reports whether a database is visible. Deny rules hide a database
+// only when they name no table or column
+func (p *AccessPolicy) DatabaseAllowed(db string) bool {
+	if !p.Enabled() {
+		return true
+	}
+	for _, rule := range p.deny {
+		if rule.Table == "" && rule.Column == "" && matchPattern(rule.Database, db) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, rule := range p.allow {
+		if matchPattern(rule.Database, db) {
+			return true
+		}
+	}
+	return false
+}
+
+// TableAllowed reports whether a table is visible. Deny rules hide a table only when they name no column
+func (p *AccessPolicy) TableAllowed(db, table string) bool {
+	if !p.Enabled() {
+		return true
+	}
+	for _, rule := range p.deny {
+		if rule.Column == "" && matchPattern(rule.Database, db) && matchPattern(rule.Table, table) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, rule := range p.allow {
+		if matchPattern(rule.Database, db) && matchPattern(rule.Table, table) {
+			return true
+		}
+	}
+	return false
+}
+
+// ColumnAllowed reports whether a column of a visible table may be read or written
+func (p *AccessPolicy) ColumnAllowed(db, table, column string) bool {
+	if !p.Enabled() {
+		return true
+	}
+	if !p.TableAllowed(db, table) {
+		return false
+	}
+	for _, rule := range p.deny {
+		if matchPattern(rule.Database, db) && matchPattern(rule.Table, table) && matchPattern(rule.Column, column) {
+			return false
+		}
+	}
+	if len(p.allow) == 0 {
+		return true
+	}
+	for _, rule := range p.allow {
+		if matchPattern(rule.Database, db) && matchPattern(rule.Table, table) && matchPattern(rule.Column, column) {
+			return true
+		}
+	}
+	return false
+}
+
+// restrictsColumns reports whether some columns of a table may not be used, so SELECT * must not expand to it
+func (p *AccessPolicy) restrictsColumns(db, table string) bool {
+	if !p.Enabled() {
+		return false
+	}
+	for _, rule := range p.deny {
+		if rule.Column != "" && matchPattern(rule.Database, db) && matchPattern(rule.Table, table) {
+			return true
+		}
+	}
+	if len(p.allow) == 0 {
+		return false
+	}
+	for _, rule := range p.allow {
+		if (rule.Column == "" || rule.Column == "*") && matchPattern(rule.Database, db) && matchPattern(rule.Table, table) {
+			return false
+		}
+	}
+	return true
+}
+
+// FilterDatabases drops the hidden databases from a SHOW DATABASES result
+func (p *AccessPolicy) FilterDatabases(result *QueryResult) {
+	if !p.Enabled() || len(result.Columns) == 0 {
+		return
+	}
+	col := result.Columns[0].Name
+	result.Rows = filterRows(result.Rows, func(row map[string]interface{}) bool {
+		return p.DatabaseAllowed(fmt.Sprint(row[col]))
+	})
+}
+
+// FilterTables drops the hidden tables from a list_table result, which has database and table columns
+func (p *AccessPolicy) FilterTables(result *QueryResult) {
+	if !p.Enabled() {
+		return
+	}
+	result.Rows = filterRows(result.Rows, func(row map[string]interface{}) bool {
+		return p.TableAllowed(fmt.Sprint(row["database"]), fmt.Sprint(row["table"]))
+	})
+}
+
+func filterRows(rows []map[string]interface{}, keep func(map[string]interface{}) bool) []map[string]interface{} {
+	kept := make([]map[string]interface{}, 0, len(rows))
+	for _, row := range rows {
+		if keep(row) {
+			kept = append(kept, row)
+		}
+	}
+	return kept
+}
+
+// Check rejects a statement that references a hidden database, table or column.
+// Unqualified names are resolved against currentDB. An unqualified column is checked
+// against every table of the statement, and * may not expand to a table with hidden columns
+func (p *AccessPolicy) Check(stmt *Statement, currentDB string) error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	refs := newTableRefCollector(currentDB)
+	stmt.Node.Accept(refs)
+
+	// Hidden tables are reported before any of their columns
+	for _, ref := range refs.tables {
+		if !p.TableAllowed(ref.db, ref.table) {
+			return fmt.Errorf("access denied: table %s is not allowed", ref)
+		}
+	}
+
+	checker := &accessChecker{policy: p, refs: refs}
+	stmt.Node.Accept(checker)
+	return checker.err
+}
+
+// tableRef is a table of a statement, resolved to its database
+type tableRef struct {
+	db    string
+	table string
+}
+
+func (r tableRef) String() string {
+	return quoteIdentifier(r.db) + "." + quoteIdentifier(r.table)
+}
+
+// tableRefCollector finds the tables of a statement, their aliases and the names that are not tables
+type tableRefCollector struct {
+	currentDB string
+	// ctes counts the common table expressions in scope by name, which shadow tables of that name
+	ctes map[string]int
+	// scopes are the names each enclosing statement with a WITH clause brought into scope
+	scopes [][]string
+	// cteRefs records for each table name reached whether it refers to a common table expression
+	cteRefs map[*ast.TableName]bool
+	// aliases maps each alias, or table name without alias, to the tables it may refer to
+	aliases map[string][]tableRef
+	tables  []tableRef
+	// aliasRefs are the table names of a multi-table DELETE, which refer to aliases
+	aliasRefs map[*ast.TableName]bool
+}
+
+// newTableRefCollector - Create a collector that resolves unqualified names against currentDB
+func newTableRefCollector(currentDB string) *tableRefCollector {
+	return &tableRefCollector{
+		currentDB: currentDB,
+		ctes:      map[string]int{},
+		cteRefs:   map[*ast.TableName]bool{},
+		aliases:   map[string][]tableRef{},
+		aliasRefs: map[*ast.TableName]bool{},
+	}
+}
+
+func (c *tableRefCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if withClause(n) != nil {
+		c.scopes = append(c.scopes, nil)
+	}
+
+	switch node := n.(type) {
+	case *ast.WithClause:
+		c.enterWith(node)
+		return n, true
+	case *ast.DeleteStmt:
+		if node.Tables != nil {
+			for _, name := range node.Tables.Tables {
+				c.aliasRefs[name] = true
+			}
+		}
+	case *ast.TableSource:
+		if name, ok := node.Source.(*ast.TableName); ok && !c.isCTE(name) {
+			alias := node.AsName.L
+			if alias == "" {
+				alias = name.Name.L
+			}
+			c.aliases[alias] = append(c.aliases[alias], c.resolve(name))
+		}
+	case *ast.TableName:
+		if !c.aliasRefs[node] && !c.isCTE(node) {
+			c.tables = append(c.tables, c.resolve(node))
+		}
+	}
+	return n, false
+}
+
+func (c *tableRefCollector) Leave(n ast.Node) (ast.Node, bool) {
+	if withClause(n) != nil {
+		for _, name := range c.scopes[len(c.scopes)-1] {
+			c.ctes[name]--
+		}
+		c.scopes = c.scopes[:len(c.scopes)-1]
+	}
+	return n, true
+}
+
+// enterWith brings the CTEs of a WITH clause into the scope of the statement that owns it. The body
+// of a CTE sees the CTEs before it, or with RECURSIVE every CTE of the clause, including itself
+func (c *tableRefCollector) enterWith(with *ast.WithClause) {
+	if len(c.scopes) == 0 {
+		c.scopes = append(c.scopes, nil)
+	}
+	declare := func(name string) {
+		c.ctes[name]++
+		c.scopes[len(c.scopes)-1] = append(c.scopes[len(c.scopes)-1], name)
+	}
+
+	if with.IsRecursive {
+		for _, cte := range with.CTEs {
+			declare(cte.Name.L)
+		}
+	}
+	for _, cte := range with.CTEs {
+		if cte.Query != nil {
+			cte.Query.Accept(c)
+		}
+		if !with.IsRecursive {
+			declare(cte.Name.L)
+		}
+	}
+}
+
+// isCTE reports whether a table name refers to a common table expression. It depends on the WITH
+// clauses in scope where the name appears, so it is decided when the collector reaches the name
+func (c *tableRefCollector) isCTE(name *ast.TableName) bool {
+	if cte, ok := c.cteRefs[name]; ok {
+		return cte
+	}
+	cte := name.Schema.L == "" && c.ctes[name.Name.L] > 0
+	c.cteRefs[name] = cte
+	return cte
+}
+
+// withClause returns the WITH clause of a statement, or nil
+func withClause(n ast.Node) *ast.WithClause {
+	switch node := n.(type) {
+	case *ast.SelectStmt:
+		return node.With
+	case *ast.SetOprStmt:
+		return node.With
+	case *ast.SetOprSelectList:
+		return node.With
+	case *ast.UpdateStmt:
+		return node.With
+	case *ast.DeleteStmt:
+		return node.With
+	}
+	return nil
+}
+
+func (c *tableRefCollector) resolve(name *ast.TableName) tableRef {
+	db := name.Schema.O
+	if db == "" {
+		db = c.currentDB
+	}
+	return tableRef{db: db, table: name.Name.O}
+}
+
+// lookup returns the tables a qualifier such as t or db.t in t.col or db.t.col refers to
+func (c *tableRefCollector) lookup(schema, table ast.CIStr) []tableRef {
+	if schema.L != "" {
+		return []tableRef{{db: schema.O, table: table.O}}
+	}
+	return c.aliases[table.L]
+}
+
+// sourceTables returns the tables directly in a FROM clause, which an unqualified * expands to
+func (c *tableRefCollector) sourceTables(node ast.ResultSetNode) []tableRef {
+	switch n := node.(type) {
+	case *ast.Join:
+		tables := c.sourceTables(n.Left)
+		if n.Right != nil {
+			tables = append(tables, c.sourceTables(n.Right)...)
+		}
+		return tables
+	case *ast.TableSource:
+		if name, ok := n.Source.(*ast.TableName); ok && !c.isCTE(name) {
+			return []tableRef{c.resolve(name)}
+		}
+	}
+	return nil
+}
+
+// accessChecker stops at the first reference the policy does not allow
+type accessChecker struct {
+	policy *AccessPolicy
+	refs   *tableRefCollector
+	err    error
+}
+
+func (c *accessChecker) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.ShowStmt:
+		c.checkShow(node)
+		// The WHERE and LIKE of SHOW filter its output columns, not table columns
+		return n, true
+	case *ast.ColumnName:
+		c.checkColumn(node)
+	case *ast.SelectStmt:
+		for _, field := range node.Fields.Fields {
+			if field.WildCard == nil {
+				continue
+			}
+			tables := c.refs.lookup(field.WildCard.Schema, field.WildCard.Table)
+			if field.WildCard.Table.L == "" && node.From != nil {
+				tables = c.refs.sourceTables(node.From.TableRefs)
+			}
+			c.checkWildcard("SELECT *", tables)
+		}
+	case *ast.InsertStmt:
+		// Without a column list the values go to every column of the table
+		if len(node.Columns) == 0 && node.Table != nil {
+			c.checkWildcard("INSERT without a column list", c.refs.sourceTables(node.Table.TableRefs))
+		}
+	}
+	return n, c.err != nil
+}
+
+func (c *accessChecker) Leave(n ast.Node) (ast.Node, bool) {
+	return n, c.err == nil
+}
+
+func (c *accessChecker) checkShow(show *ast.ShowStmt) {
+	switch show.Tp {
+	case ast.ShowDatabases, ast.ShowTables, ast.ShowTableStatus:
+		// Their output is not filtered; list_database and list_table are
+		c.err = fmt.Errorf("access denied: %s is not available while access rules are configured, use list_database or list_table", restoreNode(show))
+		return
+	}
+	if show.DBName != "" && !c.policy.DatabaseAllowed(show.DBName) {
+		c.err = fmt.Errorf("access denied: database %s is not allowed", quoteIdentifier(show.DBName))
+		return
+	}
+	if show.Table != nil {
+		ref := c.refs.resolve(show.Table)
+		if !c.policy.TableAllowed(ref.db, ref.table) {
+			c.err = fmt.Errorf("access denied: table %s is not allowed", ref)
+			return
+		}
+		switch show.Tp {
+		case ast.ShowCreateTable, ast.ShowColumns, ast.ShowIndex:
+			// They name every column of the table
+			if c.policy.restrictsColumns(ref.db, ref.table) {
+				c.err = fmt.Errorf("access denied: %s would show columns of table %s that are not allowed, use describe_table", restoreNode(show), ref)
+			}
+		}
+	}
+}
+
+func (c *accessChecker) checkColumn(col *ast.ColumnName) {
+	tables := c.refs.tables
+	if col.Table.L != "" {
+		tables = c.refs.lookup(col.Schema, col.Table)
+	}
+	for _, ref := range tables {
+		if !c.policy.ColumnAllowed(ref.db, ref.table, col.Name.O) {
+			c.err = fmt.Errorf("access denied: column %s.%s is not allowed", ref, quoteIdentifier(col.Name.O))
+			return
+		}
+	}
+}
+
+func (c *accessChecker) checkWildcard(what string, tables []tableRef) {
+	for _, ref := range tables {
+		if c.policy.restrictsColumns(ref.db, ref.table) {
+			c.err = fmt.Errorf("access denied: %s on table %s would include columns that are not allowed, name the columns instead", what, ref)
+			return
+		}
+	}
+}
+
+// matchPattern matches a name against a case-insensitive glob. An empty pattern matches everything
+func matchPattern(pattern, name string) bool {
+	if pattern == "" {
+		return true
+	}
+	ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(name))
+	return ok
+}
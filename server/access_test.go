@@ -0,0 +1,180 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAccessPolicy(t *testing.T, rules ...config.AccessRule) *AccessPolicy {
+	cfg := &config.Config{}
+	cfg.Access.Rules = rules
+	p, err := NewAccessPolicy(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return p.ForConnection(DefaultConnectionName)
+}
+
+func TestNewAccessPolicy(t *testing.T) {
+	cfg := &config.Config{}
+
+	t.Run("unknown action", func(t *testing.T) {
+		cfg.Access.Rules = []config.AccessRule{{Action: "hide", Table: "users"}}
+		_, err := NewAccessPolicy(cfg)
+		assert.ErrorContains(t, err, `unknown action "hide"`)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		cfg.Access.Rules = []config.AccessRule{{Action: "deny", Table: "users["}}
+		_, err := NewAccessPolicy(cfg)
+		assert.ErrorContains(t, err, "invalid pattern")
+	})
+
+	t.Run("rules of other connections", func(t *testing.T) {
+		cfg.Access.Rules = []config.AccessRule{{Action: "deny", Connection: "prod", Table: "users"}}
+		p, err := NewAccessPolicy(cfg)
+		assert.NoError(t, err)
+		assert.False(t, p.ForConnection("prod").TableAllowed("app", "users"))
+		assert.True(t, p.ForConnection(DefaultConnectionName).TableAllowed("app", "users"))
+	})
+
+	t.Run("nil policy", func(t *testing.T) {
+		var p *AccessPolicy
+		assert.False(t, p.Enabled())
+		assert.True(t, p.ColumnAllowed("app", "users", "password"))
+		assert.NoError(t, p.Check(&Statement{}, ""))
+	})
+}
+
+func TestAccessPolicyObjects(t *testing.T) {
+	t.Run("deny rules", func(t *testing.T) {
+		p := newTestAccessPolicy(t,
+			config.AccessRule{Action: "deny", Database: "mysql"},
+			config.AccessRule{Action: "deny", Table: "secret_*"},
+			config.AccessRule{Action: "deny", Table: "users", Column: "password"},
+		)
+		assert.False(t, p.DatabaseAllowed("MySQL"))
+		assert.True(t, p.DatabaseAllowed("app"))
+		assert.False(t, p.TableAllowed("app", "secret_keys"))
+		assert.True(t, p.TableAllowed("app", "users"))
+		assert.False(t, p.ColumnAllowed("app", "users", "password"))
+		assert.True(t, p.ColumnAllowed("app", "users", "name"))
+		assert.True(t, p.restrictsColumns("app", "users"))
+		assert.False(t, p.restrictsColumns("app", "orders"))
+	})
+
+	t.Run("allow rules", func(t *testing.T) {
+		p := newTestAccessPolicy(t,
+			config.AccessRule{Action: "allow", Database: "app", Table: "orders"},
+			config.AccessRule{Action: "allow", Database: "app", Table: "users", Column: "id"},
+			config.AccessRule{Action: "allow", Database: "app", Table: "users", Column: "name"},
+		)
+		assert.True(t, p.DatabaseAllowed("app"))
+		assert.False(t, p.DatabaseAllowed("billing"))
+		assert.False(t, p.TableAllowed("app", "products"))
+		assert.True(t, p.ColumnAllowed("app", "users", "name"))
+		assert.False(t, p.ColumnAllowed("app", "users", "email"))
+		assert.True(t, p.restrictsColumns("app", "users"))
+		assert.False(t, p.restrictsColumns("app", "orders"))
+	})
+
+	t.Run("deny wins over allow", func(t *testing.T) {
+		p := newTestAccessPolicy(t,
+			config.AccessRule{Action: "allow", Database: "app"},
+			config.AccessRule{Action: "deny", Database: "app", Table: "audit"},
+		)
+		assert.True(t, p.TableAllowed("app", "users"))
+		assert.False(t, p.TableAllowed("app", "audit"))
+	})
+}
+
+func TestAccessPolicyCheck(t *testing.T) {
+	p := newTestAccessPolicy(t,
+		config.AccessRule{Action: "deny", Database: "mysql"},
+		config.AccessRule{Action: "deny", Database: "app", Table: "secrets"},
+		config.AccessRule{Action: "deny", Database: "app", Table: "users", Column: "password"},
+		config.AccessRule{Action: "deny", Database: "app", Table: "users", Column: "password_hash"},
+	)
+	check := func(query string) error {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return p.Check(stmt, "app")
+	}
+
+	allowed := []string{
+		"SELECT id, name FROM users WHERE id = 1",
+		"SELECT u.name, o.total FROM users u JOIN orders o ON o.user_id = u.id",
+		"SELECT * FROM orders",
+		"SELECT o.* FROM users u JOIN orders o ON o.user_id = u.id",
+		"WITH secrets AS (SELECT id FROM orders) SELECT * FROM secrets",
+		"WITH RECURSIVE secrets (n) AS (SELECT 1 UNION ALL SELECT n + 1 FROM secrets WHERE n < 3) SELECT n FROM secrets",
+		"WITH a AS (SELECT id FROM orders), secrets AS (SELECT id FROM a) SELECT id FROM secrets",
+		"INSERT INTO users (id, name) VALUES (1, 'x')",
+		"UPDATE users SET name = 'x' WHERE id = 1",
+		"DELETE u FROM users u WHERE u.id = 1",
+		"SELECT name FROM other.users",
+		"SHOW CREATE TABLE orders",
+		"SHOW COLUMNS FROM orders",
+		"EXPLAIN SELECT id FROM users",
+	}
+	for _, query := range allowed {
+		assert.NoError(t, check(query), query)
+	}
+
+	denied := map[string]string{
+		"SELECT * FROM secrets":                                      "table `app`.`secrets` is not allowed",
+		"SELECT id FROM app.secrets":                                 "table `app`.`secrets` is not allowed",
+		"SELECT user FROM mysql.user":                                "table `mysql`.`user` is not allowed",
+		"SELECT id FROM orders WHERE id IN (SELECT id FROM secrets)": "table `app`.`secrets` is not allowed",
+		"SELECT password FROM users":                                 "column `app`.`users`.`password` is not allowed",
+		"SELECT u.password FROM users u":                             "column `app`.`users`.`password` is not allowed",
+		"SELECT id FROM users ORDER BY password":                     "column `app`.`users`.`password` is not allowed",
+		"SELECT o.id FROM orders o JOIN users u ON u.id = o.user_id WHERE password = 'x'": "column `app`.`users`.`password` is not allowed",
+		"SELECT * FROM users":                          "SELECT * on table `app`.`users`",
+		"SELECT u.* FROM users u":                      "SELECT * on table `app`.`users`",
+		"INSERT INTO users VALUES (1, 'x', 'y')":       "INSERT without a column list on table `app`.`users`",
+		"UPDATE users SET password = 'x' WHERE id = 1": "column `app`.`users`.`password` is not allowed",
+		"DELETE FROM secrets WHERE id = 1":             "table `app`.`secrets` is not allowed",
+		"SHOW CREATE TABLE secrets":                    "table `app`.`secrets` is not allowed",
+		"SHOW TABLES FROM mysql":                       "use list_database or list_table",
+		"SHOW COLUMNS FROM secrets":                    "table `app`.`secrets` is not allowed",
+		"SHOW CREATE TABLE users":                      "SHOW CREATE TABLE `users` would show columns of table `app`.`users` that are not allowed",
+		"DESCRIBE users":                               "would show columns of table `app`.`users`",
+		"SELECT (WITH secrets AS (SELECT 1) SELECT 1) AS x, s.* FROM secrets s":         "table `app`.`secrets` is not allowed",
+		"SELECT (WITH users AS (SELECT 1) SELECT 1) AS x, u.password_hash FROM users u": "column `app`.`users`.`password_hash` is not allowed",
+		"WITH secrets AS (SELECT * FROM secrets) SELECT * FROM secrets":                 "table `app`.`secrets` is not allowed",
+		"SHOW INDEX FROM users": "would show columns of table `app`.`users`",
+	}
+	for query, message := range denied {
+		assert.ErrorContains(t, check(query), message, query)
+	}
+}
+
+func TestAccessPolicyFilter(t *testing.T) {
+	p := newTestAccessPolicy(t,
+		config.AccessRule{Action: "deny", Database: "mysql"},
+		config.AccessRule{Action: "deny", Database: "app", Table: "secrets"},
+	)
+
+	t.Run("databases", func(t *testing.T) {
+		result := &QueryResult{
+			Columns: []ColumnInfo{{Name: "Database"}},
+			Rows:    []map[string]interface{}{{"Database": "app"}, {"Database": "mysql"}},
+		}
+		p.FilterDatabases(result)
+		assert.Equal(t, []map[string]interface{}{{"Database": "app"}}, result.Rows)
+	})
+
+	t.Run("tables", func(t *testing.T) {
+		result := &QueryResult{
+			Columns: []ColumnInfo{{Name: "database"}, {Name: "table"}},
+			Rows:    []map[string]interface{}{{"database": "app", "table": "secrets"}, {"database": "app", "table": "users"}},
+		}
+		p.FilterTables(result)
+		assert.Equal(t, []map[string]interface{}{{"database": "app", "table": "users"}}, result.Rows)
+	})
+}
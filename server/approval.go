@@ -0,0 +1,187 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// approvalCountLimit is how many matched rows the estimate of an approval request counts at most
+const approvalCountLimit = 10000
+
+// Elicitor sends an MCP elicitation request to the client of the calling session. *server.MCPServer implements it
+type Elicitor interface {
+	RequestElicitation(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error)
+}
+
+// Approver asks the user to confirm each write on connections with require_approval
+type Approver struct {
+	elicitor Elicitor
+	// timeout is how long the user has to answer. 0 waits until the tool call is cancelled
+	timeout time.Duration
+}
+
+// NewApprover - Create an approver that asks through the given elicitor
+func NewApprover(cfg *config.Config, elicitor Elicitor) *Approver {
+	return &Approver{elicitor: elicitor, timeout: cfg.Write.ApprovalTimeout}
+}
+
+// approvalSchema is the form the client shows: a single checkbox the user must tick
+var approvalSchema = map[string]any{
+	"type": "object",
+	"properties": map[string]any{
+		"approve": map[string]any{
+			"type":        "boolean",
+			"title":       "Run this statement",
+			"description": "Tick to run the statement exactly as shown",
+			"default":     false,
+		},
+	},
+	"required": []string{"approve"},
+}
+
+// Approve asks the user to confirm a write when the connection requires approval and returns nil
+// only if they accepted. The statement is checked first, so the user is never asked about a write
+// that would be rejected anyway. t is the transaction the write runs in, or nil.
+// Every failure, including a client without elicitation support, refuses the write
+func (a *Approver) Approve(ctx context.Context, conn *Connection, t *Transaction, query, expect string, args []interface{}, opts WriteOptions) error {
+	if !conn.Config.RequireApproval {
+		return nil
+	}
+	if a == nil {
+		return fmt.Errorf("connection %q requires approval of every write, but approvals are not available. The statement was not run", conn.Name)
+	}
+
+	stmt, err := CheckStatement(query, expect)
+	if err != nil {
+		return err
+	}
+	if err := conn.Access.Check(stmt, conn.Database); err != nil {
+		return err
+	}
+	if _, err := checkWrite(query, opts); err != nil {
+		return err
+	}
+
+	if !supportsElicitation(ctx) {
+		return fmt.Errorf("connection %q requires approval of every write, but the client does not support elicitation. The statement was not run", conn.Name)
+	}
+
+	request := mcp.ElicitationRequest{}
+	request.Params.Message = approvalMessage(conn, t, stmt, args, estimateRows(ctx, conn, t, stmt, args, opts))
+	request.Params.RequestedSchema = approvalSchema
+
+	if t != nil {
+		// The transaction must not expire while the user reads the statement
+		release := t.hold()
+		defer release()
+	}
+	if a.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.timeout)
+		defer cancel()
+	}
+	result, err := a.elicitor.RequestElicitation(ctx, request)
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("the write was not approved within %s. The statement was not run", a.timeout)
+		}
+		return fmt.Errorf("failed to ask for approval: %v. The statement was not run", err)
+	}
+
+	switch result.Action {
+	case mcp.ElicitationResponseActionAccept:
+		if content, ok := result.Content.(map[string]any); ok && content["approve"] == true {
+			return nil
+		}
+		return fmt.Errorf("the write was not approved: the approval box was not ticked. The statement was not run")
+	case mcp.ElicitationResponseActionDecline:
+		return fmt.Errorf("the user declined the write. The statement was not run")
+	default:
+		return fmt.Errorf("the user cancelled the approval. The statement was not run")
+	}
+}
+
+// supportsElicitation reports whether the client of the calling session announced elicitation support
+func supportsElicitation(ctx context.Context) bool {
+	session := server.ClientSessionFromContext(ctx)
+	if _, ok := session.(server.SessionWithElicitation); !ok {
+		return false
+	}
+	if info, ok := session.(server.SessionWithClientInfo); ok {
+		return info.GetClientCapabilities().Elicitation != nil
+	}
+	return true
+}
+
+// estimateRows describes how many rows a write is expected to change
+func estimateRows(ctx context.Context, conn *Connection, t *Transaction, stmt *Statement, args []interface{}, opts WriteOptions) string {
+	switch n := stmt.Node.(type) {
+	case *ast.InsertStmt:
+		if n.Select == nil && len(n.Lists) > 0 {
+			return fmt.Sprintf("%d rows", len(n.Lists))
+		}
+		return "unknown, the rows come from a SELECT"
+	case *ast.UpdateStmt, *ast.DeleteStmt:
+		plan, err := newMatchPlan(stmt, args, approvalCountLimit+1)
+		if err != nil {
+			return fmt.Sprintf("unknown (%v)", err)
+		}
+		if plan == nil {
+			return "unknown, the statement uses several tables"
+		}
+
+		query := matchCountQuery(plan)
+		var result *QueryResult
+		if t != nil {
+			result, err = t.Query(ctx, query, StatementTypeNoExplainCheck, plan.args, opts.Query)
+		} else {
+			result, err = DoQuery(ctx, conn, query, StatementTypeNoExplainCheck, plan.args, opts.Query)
+		}
+		if err != nil {
+			return fmt.Sprintf("unknown, counting the matched rows failed (%v)", err)
+		}
+		if len(result.Rows) == 0 || len(result.Columns) == 0 {
+			return "unknown"
+		}
+		count := fmt.Sprint(result.Rows[0][result.Columns[0].Name])
+		if count == fmt.Sprint(approvalCountLimit+1) {
+			return fmt.Sprintf("more than %d rows", approvalCountLimit)
+		}
+		return count + " rows (matched by the WHERE clause)"
+	default:
+		return "not applicable, the statement changes the schema"
+	}
+}
+
+// approvalMessage describes a write for the user to approve
+func approvalMessage(conn *Connection, t *Transaction, stmt *Statement, args []interface{}, estimate string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Approve this %s?\n\n", stmt.Kind)
+	fmt.Fprintf(&b, "Connection: %s", conn.Name)
+	if conn.Target != "" {
+		fmt.Fprintf(&b, " (%s)", conn.Target)
+	}
+	b.WriteString("\n")
+	if t != nil {
+		fmt.Fprintf(&b, "Transaction: %s\n", t.ID)
+	}
+	fmt.Fprintf(&b, "Estimated rows affected: %s\n", estimate)
+	fmt.Fprintf(&b, "\nStatement:\n%s\n", stmt.Text)
+	if len(args) > 0 {
+		params, err := json.Marshal(args)
+		if err != nil {
+			params = []byte(fmt.Sprint(args))
+		}
+		fmt.Fprintf(&b, "\nParameters: %s\n", params)
+	}
+	return b.String()
+}
@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeSession is a client session that may announce elicitation support
+type fakeSession struct {
+	capabilities mcp.ClientCapabilities
+}
+
+func (s *fakeSession) Initialize()                                         {}
+func (s *fakeSession) Initialized() bool                                   { return true }
+func (s *fakeSession) NotificationChannel() chan<- mcp.JSONRPCNotification { return nil }
+func (s *fakeSession) SessionID() string                                   { return "session-1" }
+func (s *fakeSession) GetClientInfo() mcp.Implementation                   { return mcp.Implementation{} }
+func (s *fakeSession) SetClientInfo(mcp.Implementation)                    {}
+func (s *fakeSession) GetClientCapabilities() mcp.ClientCapabilities       { return s.capabilities }
+func (s *fakeSession) SetClientCapabilities(mcp.ClientCapabilities)        {}
+func (s *fakeSession) RequestElicitation(context.Context, mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	return nil, nil
+}
+
+// fakeElicitor answers every elicitation request with a fixed response
+type fakeElicitor struct {
+	response mcp.ElicitationResponse
+	requests []mcp.ElicitationRequest
+}
+
+func (e *fakeElicitor) RequestElicitation(ctx context.Context, request mcp.ElicitationRequest) (*mcp.ElicitationResult, error) {
+	e.requests = append(e.requests, request)
+	return &mcp.ElicitationResult{ElicitationResponse: e.response}, nil
+}
+
+func TestApproverApprove(t *testing.T) {
+	conn := &Connection{Name: "prod", Target: "app@tcp(db:3306)/shop", Config: config.MySQLConfig{RequireApproval: true}}
+	query := "INSERT INTO users (name) VALUES (?), (?)"
+	args := []interface{}{"alice", "bob"}
+
+	srv := server.NewMCPServer("test", "1.0.0")
+	withSession := func(capabilities mcp.ClientCapabilities) context.Context {
+		return srv.WithContext(context.Background(), &fakeSession{capabilities: capabilities})
+	}
+	elicitation := mcp.ClientCapabilities{Elicitation: &struct{}{}}
+
+	t.Run("accepted", func(t *testing.T) {
+		elicitor := &fakeElicitor{response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionAccept, Content: map[string]any{"approve": true}}}
+		a := &Approver{elicitor: elicitor}
+		assert.NoError(t, a.Approve(withSession(elicitation), conn, nil, query, StatementTypeInsert, args, WriteOptions{}))
+
+		if assert.Len(t, elicitor.requests, 1) {
+			assert.Equal(t, "Approve this INSERT?\n\n"+
+				"Connection: prod (app@tcp(db:3306)/shop)\n"+
+				"Estimated rows affected: 2 rows\n"+
+				"\nStatement:\nINSERT INTO users (name) VALUES (?), (?)\n"+
+				"\nParameters: [\"alice\",\"bob\"]\n", elicitor.requests[0].Params.Message)
+		}
+	})
+
+	t.Run("accepted without ticking the box", func(t *testing.T) {
+		a := &Approver{elicitor: &fakeElicitor{response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionAccept, Content: map[string]any{"approve": false}}}}
+		assert.ErrorContains(t, a.Approve(withSession(elicitation), conn, nil, query, StatementTypeInsert, args, WriteOptions{}), "was not ticked")
+	})
+
+	t.Run("declined", func(t *testing.T) {
+		a := &Approver{elicitor: &fakeElicitor{response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionDecline}}}
+		assert.ErrorContains(t, a.Approve(withSession(elicitation), conn, nil, query, StatementTypeInsert, args, WriteOptions{}), "declined")
+	})
+
+	t.Run("client without elicitation", func(t *testing.T) {
+		elicitor := &fakeElicitor{response: mcp.ElicitationResponse{Action: mcp.ElicitationResponseActionAccept, Content: map[string]any{"approve": true}}}
+		a := &Approver{elicitor: elicitor}
+		err := a.Approve(withSession(mcp.ClientCapabilities{}), conn, nil, query, StatementTypeInsert, args, WriteOptions{})
+		assert.ErrorContains(t, err, "does not support elicitation")
+		err = a.Approve(context.Background(), conn, nil, query, StatementTypeInsert, args, WriteOptions{})
+		assert.ErrorContains(t, err, "does not support elicitation")
+		assert.Empty(t, elicitor.requests)
+	})
+
+	t.Run("rejected statements are not shown", func(t *testing.T) {
+		elicitor := &fakeElicitor{}
+		a := &Approver{elicitor: elicitor}
+		err := a.Approve(withSession(elicitation), conn, nil, "DELETE FROM users", StatementTypeDelete, nil, WriteOptions{RequireWhere: true})
+		assert.ErrorContains(t, err, "without a WHERE clause")
+		assert.Empty(t, elicitor.requests)
+	})
+
+	t.Run("not required", func(t *testing.T) {
+		var a *Approver
+		assert.NoError(t, a.Approve(context.Background(), &Connection{Name: "dev"}, nil, query, StatementTypeInsert, args, WriteOptions{}))
+		assert.ErrorContains(t, a.Approve(context.Background(), conn, nil, query, StatementTypeInsert, args, WriteOptions{}), "approvals are not available")
+	})
+}
+
+func TestEstimateRows(t *testing.T) {
+	estimate := func(query string) string {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		return estimateRows(context.Background(), &Connection{}, nil, stmt, nil, WriteOptions{})
+	}
+
+	assert.Equal(t, "3 rows", estimate("INSERT INTO t (a) VALUES (1), (2), (3)"))
+	assert.Equal(t, "1 rows", estimate("INSERT INTO t SET a = 1"))
+	assert.Equal(t, "unknown, the rows come from a SELECT", estimate("INSERT INTO t (a) SELECT a FROM s"))
+	assert.Equal(t, "unknown, the statement uses several tables", estimate("DELETE t FROM t JOIN s ON s.id = t.id WHERE s.x = 1"))
+	assert.Equal(t, "not applicable, the statement changes the schema", estimate("ALTER TABLE t ADD COLUMN b INT"))
+}
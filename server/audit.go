@@ -0,0 +1,343 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	AuditOutcomeOK    = "ok"
+	AuditOutcomeError = "error"
+
+	// auditTableTimeout bounds each insert into the audit table
+	auditTableTimeout = 5 * time.Second
+	// auditQueueSize is how many records may wait for the audit table. Further records are only logged to the file
+	auditQueueSize = 1024
+	// auditDrainTimeout bounds how long Close waits for the queued records to reach the audit table
+	auditDrainTimeout = 10 * time.Second
+)
+
+// AuditRecord is one line of the audit log, describing a single tool call
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	SessionID string    `json:"session_id,omitempty"`
+	// Client is the name and version the MCP client reported when it initialized the session
+	Client    string `json:"client,omitempty"`
+	Principal string `json:"principal,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Tool      string `json:"tool"`
+	// Connection is the profile name and Target the address it resolves to, without the password
+	Connection    string `json:"connection,omitempty"`
+	Target        string `json:"target,omitempty"`
+	TransactionID string `json:"transaction_id,omitempty"`
+	Query         string `json:"query,omitempty"`
+	Params        any    `json:"params,omitempty"`
+	// Arguments holds the other tool arguments, such as format or dry_run
+	Arguments    map[string]any `json:"arguments,omitempty"`
+	RowsReturned *int           `json:"rows_returned,omitempty"`
+	RowsAffected *int64         `json:"rows_affected,omitempty"`
+	DurationMs   float64        `json:"duration_ms"`
+	Outcome      string         `json:"outcome"`
+	Error        string         `json:"error,omitempty"`
+}
+
+type auditRecordKey struct{}
+
+// recordRowsAffected notes the rows a write changed on the audit record of the tool call, if any
+func recordRowsAffected(ctx context.Context, n int64) {
+	if record, ok := ctx.Value(auditRecordKey{}).(*AuditRecord); ok {
+		record.RowsAffected = &n
+	}
+}
+
+// Auditor writes an AuditRecord for every tool call to a rotating file and optionally to a MySQL table
+type Auditor struct {
+	registry *Registry
+	file     io.WriteCloser
+	table    string
+	// connection is the profile of the audit table
+	connection string
+
+	// mu serializes writes to the audit file
+	mu sync.Mutex
+	// tableMu guards the creation of the audit table
+	tableMu      sync.Mutex
+	tableCreated bool
+
+	// queue holds the records a background writer inserts into the audit table, so tool calls
+	// never wait for it. drained is closed once the writer has emptied the closed queue
+	queueMu sync.Mutex
+	queue   chan auditRow
+	drained chan struct{}
+}
+
+// auditRow is a record waiting for the audit table, with its JSON encoding
+type auditRow struct {
+	record *AuditRecord
+	line   []byte
+}
+
+// NewAuditor - Create the auditor from the audit configuration, or nil when auditing is disabled
+func NewAuditor(cfg *config.Config, registry *Registry) (*Auditor, error) {
+	if cfg.Audit.Path == "" && cfg.Audit.Table == "" {
+		return nil, nil
+	}
+
+	a := &Auditor{registry: registry, connection: cfg.Audit.Connection}
+	if cfg.Audit.Table != "" {
+		if _, _, err := registry.Profile(cfg.Audit.Connection); err != nil {
+			return nil, fmt.Errorf("audit table connection: %v", err)
+		}
+		a.table = auditTableName(cfg.Audit.Table)
+		a.queue = make(chan auditRow, auditQueueSize)
+		a.drained = make(chan struct{})
+		go a.insertQueued(a.queue)
+	}
+	if cfg.Audit.Path != "" {
+		a.file = &lumberjack.Logger{
+			Filename:   cfg.Audit.Path,
+			MaxSize:    cfg.Audit.MaxSizeMB,
+			MaxBackups: cfg.Audit.MaxBackups,
+			MaxAge:     cfg.Audit.MaxAgeDays,
+			Compress:   cfg.Audit.Compress,
+		}
+	}
+	return a, nil
+}
+
+// auditTableName quotes a table name that may be qualified with its database
+func auditTableName(name string) string {
+	parts := strings.SplitN(name, ".", 2)
+	for i, part := range parts {
+		parts[i] = quoteIdentifier(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// Close waits for the queued records to reach the audit table and closes the audit file
+func (a *Auditor) Close() error {
+	if a == nil {
+		return nil
+	}
+
+	a.queueMu.Lock()
+	queue := a.queue
+	a.queue = nil
+	a.queueMu.Unlock()
+	if queue != nil {
+		close(queue)
+		select {
+		case <-a.drained:
+		case <-time.After(auditDrainTimeout):
+			zap.S().Warnw("audit records were not inserted before shutdown", "table", a.table, "records", len(queue))
+		}
+	}
+
+	if a.file == nil {
+		return nil
+	}
+	return a.file.Close()
+}
+
+// ToolMiddleware records every tool call, including calls rejected by later middleware
+func (a *Auditor) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			record := a.newRecord(ctx, request)
+			start := time.Now()
+
+			result, err := next(context.WithValue(ctx, auditRecordKey{}, record), request)
+
+			record.DurationMs = float64(time.Since(start).Microseconds()) / 1000
+			completeAuditRecord(record, result, err)
+			a.write(record)
+			return result, err
+		}
+	}
+}
+
+// newRecord describes the caller and the arguments of a tool call
+func (a *Auditor) newRecord(ctx context.Context, request mcp.CallToolRequest) *AuditRecord {
+	record := &AuditRecord{
+		Time:      time.Now().UTC(),
+		SessionID: sessionID(ctx),
+		Tool:      request.Params.Name,
+		Arguments: map[string]any{},
+	}
+
+	if session, ok := server.ClientSessionFromContext(ctx).(server.SessionWithClientInfo); ok {
+		info := session.GetClientInfo()
+		record.Client = strings.TrimSpace(info.Name + " " + info.Version)
+	}
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		record.Principal = principal.Name
+		record.Role = principal.Role
+	}
+
+	for key, value := range request.GetArguments() {
+		switch key {
+		case "query":
+			record.Query, _ = value.(string)
+		case "params":
+			record.Params = value
+		case "transaction_id":
+			record.TransactionID, _ = value.(string)
+		case "connection", "dsn":
+			// Described by Connection and Target, as a DSN may contain a password
+		default:
+			record.Arguments[key] = value
+		}
+	}
+
+	record.Connection, record.Target = a.target(ctx, request, record.TransactionID)
+	return record
+}
+
+// target resolves the connection a tool call runs on. Errors leave it empty, the tool reports them itself
+func (a *Auditor) target(ctx context.Context, request mcp.CallToolRequest, transactionID string) (string, string) {
+	name, toolDSN := request.GetString("connection", ""), request.GetString("dsn", "")
+	if transactionID != "" {
+		t, err := a.registry.Transactions().Get(transactionID, sessionID(ctx))
+		if err != nil {
+			return "", ""
+		}
+		name, toolDSN = t.Connection.Name, ""
+	}
+
+	name, profile, err := a.registry.Profile(name)
+	if err != nil {
+		return "", ""
+	}
+	dsn, err := BuildDSN(profile, toolDSN)
+	if err != nil {
+		return name, ""
+	}
+	return name, RedactDSN(dsn)
+}
+
+// RedactDSN describes the server and database of a driver DSN without its password and parameters
+func RedactDSN(dsn string) string {
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%s@%s(%s)/%s", mysqlCfg.User, mysqlCfg.Net, mysqlCfg.Addr, mysqlCfg.DBName)
+}
+
+// completeAuditRecord adds the outcome of the tool call to its record
+func completeAuditRecord(record *AuditRecord, result *mcp.CallToolResult, err error) {
+	record.Outcome = AuditOutcomeOK
+	switch {
+	case err != nil:
+		record.Outcome = AuditOutcomeError
+		record.Error = err.Error()
+		return
+	case result == nil:
+		return
+	case result.IsError:
+		record.Outcome = AuditOutcomeError
+		texts := []string{}
+		for _, content := range result.Content {
+			if text, ok := mcp.AsTextContent(content); ok {
+				texts = append(texts, text.Text)
+			}
+		}
+		record.Error = strings.Join(texts, "\n")
+		return
+	}
+
+	if structured, ok := result.StructuredContent.(StructuredResult); ok {
+		rows := structured.RowCount
+		record.RowsReturned = &rows
+		// fetch_more has no connection argument, its cursor knows where it reads from
+		if structured.Connection != "" && structured.Connection != record.Connection {
+			record.Connection, record.Target = structured.Connection, ""
+		}
+	}
+}
+
+// write appends the record to the audit file and queues it for the audit table.
+// Failures are logged, they never fail the tool call
+func (a *Auditor) write(record *AuditRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		zap.S().Errorw("failed to encode audit record", "tool", record.Tool, "error", err)
+		return
+	}
+
+	if a.file != nil {
+		a.mu.Lock()
+		_, err := a.file.Write(append(line, '\n'))
+		a.mu.Unlock()
+		if err != nil {
+			zap.S().Errorw("failed to write audit log", "error", err)
+		}
+	}
+
+	a.queueMu.Lock()
+	defer a.queueMu.Unlock()
+	if a.queue == nil {
+		return
+	}
+	select {
+	case a.queue <- auditRow{record: record, line: line}:
+	default:
+		zap.S().Errorw("audit table queue is full, record not inserted", "table", a.table, "tool", record.Tool)
+	}
+}
+
+// insertQueued inserts the queued records into the audit table until the queue is closed
+func (a *Auditor) insertQueued(queue <-chan auditRow) {
+	defer close(a.drained)
+	for row := range queue {
+		if err := a.insert(row.record, row.line); err != nil {
+			zap.S().Errorw("failed to insert audit record", "table", a.table, "error", err)
+		}
+	}
+}
+
+// insert adds the record to the audit table, creating the table on first use
+func (a *Auditor) insert(record *AuditRecord, line []byte) error {
+	conn, err := a.registry.Get(a.connection, "")
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), auditTableTimeout)
+	defer cancel()
+
+	a.tableMu.Lock()
+	if !a.tableCreated {
+		if _, err := conn.DB.ExecContext(ctx, fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			id BIGINT UNSIGNED NOT NULL AUTO_INCREMENT PRIMARY KEY,
+			created_at DATETIME(6) NOT NULL,
+			session_id VARCHAR(255) NOT NULL DEFAULT '',
+			tool VARCHAR(64) NOT NULL,
+			connection VARCHAR(255) NOT NULL DEFAULT '',
+			outcome VARCHAR(16) NOT NULL,
+			record JSON NOT NULL,
+			KEY created_at (created_at)
+		) COMMENT = 'Audit log of MCP MySQL Server tool calls'`, a.table)); err != nil {
+			a.tableMu.Unlock()
+			return err
+		}
+		a.tableCreated = true
+	}
+	a.tableMu.Unlock()
+
+	_, err = conn.DB.ExecContext(ctx, fmt.Sprintf("INSERT INTO %s (created_at, session_id, tool, connection, outcome, record) VALUES (?, ?, ?, ?, ?, ?)", a.table),
+		record.Time, record.SessionID, record.Tool, record.Connection, record.Outcome, string(line))
+	return err
+}
@@ -0,0 +1,144 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+// bufferCloser is an audit file kept in memory
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (b *bufferCloser) Close() error { return nil }
+
+func TestNewAuditor(t *testing.T) {
+	cfg := &config.Config{}
+	registry := NewRegistry(cfg)
+
+	t.Run("disabled", func(t *testing.T) {
+		a, err := NewAuditor(cfg, registry)
+		assert.NoError(t, err)
+		assert.Nil(t, a)
+		assert.NoError(t, a.Close())
+	})
+
+	t.Run("table records are inserted in the background", func(t *testing.T) {
+		c := &config.Config{}
+		c.MySQL = config.MySQLConfig{Host: "127.0.0.1", User: "root", Port: 1}
+		c.Audit.Table = "audit_log"
+		a, err := NewAuditor(c, NewRegistry(c))
+		assert.NoError(t, err)
+
+		handler := a.ToolMiddleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		})
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "list_database"
+		_, err = handler(context.Background(), request)
+		assert.NoError(t, err)
+
+		// Close waits for the writer, whose insert fails without a database
+		assert.NoError(t, a.Close())
+		assert.Nil(t, a.queue)
+		a.write(&AuditRecord{Tool: "list_database"})
+	})
+
+	t.Run("unknown table connection", func(t *testing.T) {
+		cfg.Audit.Table = "audit_log"
+		cfg.Audit.Connection = "missing"
+		_, err := NewAuditor(cfg, registry)
+		assert.ErrorContains(t, err, `unknown connection "missing"`)
+	})
+}
+
+func TestAuditorToolMiddleware(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.MySQL = config.MySQLConfig{Host: "db.internal", User: "app", Password: "hunter2", Port: 3306, Database: "shop"}
+	file := &bufferCloser{}
+	a := &Auditor{registry: NewRegistry(cfg), file: file}
+
+	call := func(handler func(ctx context.Context) (*mcp.CallToolResult, error), name string, args map[string]any) AuditRecord {
+		file.Reset()
+		request := mcp.CallToolRequest{}
+		request.Params.Name = name
+		request.Params.Arguments = args
+		_, _ = a.ToolMiddleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return handler(ctx)
+		})(WithPrincipal(context.Background(), &Principal{Name: "alice", Role: "admin"}), request)
+
+		var record AuditRecord
+		assert.NoError(t, json.Unmarshal(file.Bytes(), &record))
+		assert.Equal(t, byte('\n'), file.Bytes()[file.Len()-1])
+		return record
+	}
+
+	t.Run("read", func(t *testing.T) {
+		record := call(func(ctx context.Context) (*mcp.CallToolResult, error) {
+			result := &QueryResult{Rows: []map[string]interface{}{{"id": 1}, {"id": 2}}, connection: DefaultConnectionName}
+			return mcp.NewToolResultStructured(NewStructuredResult(result), "id\n1\n2\n"), nil
+		}, "read_query", map[string]any{"query": "SELECT id FROM users WHERE id > ?", "params": []any{0}, "format": "csv"})
+
+		assert.Equal(t, "read_query", record.Tool)
+		assert.Equal(t, "alice", record.Principal)
+		assert.Equal(t, "admin", record.Role)
+		assert.Equal(t, DefaultConnectionName, record.Connection)
+		assert.Equal(t, "app@tcp(db.internal:3306)/shop", record.Target)
+		assert.Equal(t, "SELECT id FROM users WHERE id > ?", record.Query)
+		assert.Equal(t, []any{float64(0)}, record.Params)
+		assert.Equal(t, map[string]any{"format": "csv"}, record.Arguments)
+		if assert.NotNil(t, record.RowsReturned) {
+			assert.Equal(t, 2, *record.RowsReturned)
+		}
+		assert.Nil(t, record.RowsAffected)
+		assert.Equal(t, AuditOutcomeOK, record.Outcome)
+	})
+
+	t.Run("write", func(t *testing.T) {
+		record := call(func(ctx context.Context) (*mcp.CallToolResult, error) {
+			summary, err := execSummary(ctx, fixedResult(3), StatementTypeUpdate)
+			return mcp.NewToolResultText(summary), err
+		}, "update_query", map[string]any{"query": "UPDATE users SET name = 'x' WHERE id < 4", "dsn": "app:secret@tcp(other:3306)/shop"})
+
+		assert.Equal(t, "app@tcp(other:3306)/shop", record.Target)
+		assert.NotContains(t, fmt.Sprint(record.Arguments), "secret")
+		if assert.NotNil(t, record.RowsAffected) {
+			assert.Equal(t, int64(3), *record.RowsAffected)
+		}
+	})
+
+	t.Run("error", func(t *testing.T) {
+		record := call(func(ctx context.Context) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError("access denied: table `shop`.`secrets` is not allowed"), nil
+		}, "read_query", map[string]any{"query": "SELECT * FROM secrets"})
+
+		assert.Equal(t, AuditOutcomeError, record.Outcome)
+		assert.Equal(t, "access denied: table `shop`.`secrets` is not allowed", record.Error)
+	})
+
+	t.Run("unknown connection", func(t *testing.T) {
+		record := call(func(ctx context.Context) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultError(`unknown connection "nope"`), nil
+		}, "list_table", map[string]any{"connection": "nope"})
+
+		assert.Equal(t, "", record.Connection)
+		assert.Equal(t, "", record.Target)
+	})
+}
+
+func TestRedactDSN(t *testing.T) {
+	assert.Equal(t, "root@tcp(localhost:3306)/app", RedactDSN("root:password@tcp(localhost:3306)/app?parseTime=true"))
+	assert.Equal(t, "", RedactDSN("not a dsn"))
+}
+
+func TestAuditTableName(t *testing.T) {
+	assert.Equal(t, "`audit_log`", auditTableName("audit_log"))
+	assert.Equal(t, "`ops`.`audit_log`", auditTableName("ops.audit_log"))
+}
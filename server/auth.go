@@ -0,0 +1,250 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// Principal is the authenticated caller of the http transport
+type Principal struct {
+	Name string
+	Role string
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx carrying the authenticated caller
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, principal)
+}
+
+// PrincipalFromContext returns the authenticated caller, or nil for unauthenticated transports such as stdio
+func PrincipalFromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(principalKey{}).(*Principal)
+	return principal
+}
+
+// Authenticator checks bearer tokens and client certificates and maps callers to roles
+type Authenticator struct {
+	tokens    []config.AuthToken
+	certRoles map[string]string
+	roles     map[string][]string
+	// allowAnonymous lets the http transport run without any authentication method
+	allowAnonymous bool
+}
+
+// NewAuthenticator - Create an authenticator from the auth configuration, loading the token file if set
+func NewAuthenticator(cfg *config.Config) (*Authenticator, error) {
+	a := &Authenticator{
+		tokens:    append([]config.AuthToken{}, cfg.Auth.Tokens...),
+		certRoles: cfg.Auth.ClientCertRoles,
+		roles:     cfg.Auth.Roles,
+
+		allowAnonymous: cfg.Auth.AllowAnonymous,
+	}
+
+	if cfg.Auth.TokenFile != "" {
+		tokens, err := LoadTokenFile(cfg.Auth.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = append(a.tokens, tokens...)
+	}
+
+	for i, token := range a.tokens {
+		if token.Token == "" {
+			return nil, fmt.Errorf("auth token %d (%s) is empty", i, token.Name)
+		}
+		if _, ok := a.roles[token.Role]; !ok {
+			return nil, fmt.Errorf("auth token %d (%s) has undefined role %q", i, token.Name, token.Role)
+		}
+	}
+	for cn, role := range a.certRoles {
+		if _, ok := a.roles[role]; !ok {
+			return nil, fmt.Errorf("client certificate %q has undefined role %q", cn, role)
+		}
+	}
+
+	return a, nil
+}
+
+// LoadTokenFile reads bearer tokens from a file with one `<token> <role> [name]` entry per line.
+// Blank lines and lines starting with # are ignored
+func LoadTokenFile(filename string) ([]config.AuthToken, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open token file: %v", err)
+	}
+	defer f.Close()
+
+	tokens := []config.AuthToken{}
+	scanner := bufio.NewScanner(f)
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return nil, fmt.Errorf("invalid token file entry at line %d, expected `<token> <role> [name]`", lineNo)
+		}
+
+		token := config.AuthToken{Token: fields[0], Role: fields[1], Name: fmt.Sprintf("%s:%d", filename, lineNo)}
+		if len(fields) == 3 {
+			token.Name = fields[2]
+		}
+		tokens = append(tokens, token)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read token file: %v", err)
+	}
+
+	return tokens, nil
+}
+
+// Enabled reports whether any authentication method is configured
+func (a *Authenticator) Enabled() bool {
+	return len(a.tokens) > 0 || len(a.certRoles) > 0
+}
+
+// Authenticate identifies the caller of an HTTP request by bearer token or verified client certificate
+func (a *Authenticator) Authenticate(r *http.Request) (*Principal, error) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, credential, ok := strings.Cut(header, " ")
+		if !ok || !strings.EqualFold(scheme, "Bearer") {
+			return nil, fmt.Errorf("unsupported authorization scheme")
+		}
+
+		// Compare against every token so the response time does not reveal a partial match
+		var principal *Principal
+		for _, token := range a.tokens {
+			if subtle.ConstantTimeCompare([]byte(strings.TrimSpace(credential)), []byte(token.Token)) == 1 {
+				principal = &Principal{Name: token.Name, Role: token.Role}
+			}
+		}
+		if principal == nil {
+			return nil, fmt.Errorf("invalid bearer token")
+		}
+		return principal, nil
+	}
+
+	// The TLS handshake has already verified the chain against the client CA
+	if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 {
+		cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+		if role, ok := a.certRoles[cn]; ok {
+			return &Principal{Name: cn, Role: role}, nil
+		}
+		return nil, fmt.Errorf("client certificate %q is not mapped to a role", cn)
+	}
+
+	return nil, fmt.Errorf("missing credentials")
+}
+
+// Middleware rejects unauthenticated requests before they reach the MCP handlers
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := a.Authenticate(r)
+		if err != nil {
+			zap.S().Warnw("rejected unauthenticated request",
+				"remote_addr", r.RemoteAddr,
+				"path", r.URL.Path,
+				"error", err,
+			)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="mcp-mysql"`)
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// Allowed reports whether the role may call the tool
+func (a *Authenticator) Allowed(role, tool string) bool {
+	for _, pattern := range a.roles[role] {
+		if ok, _ := path.Match(pattern, tool); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ToolMiddleware rejects tool calls the caller's role does not permit
+func (a *Authenticator) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			principal := PrincipalFromContext(ctx)
+			if principal != nil && !a.Allowed(principal.Role, request.Params.Name) {
+				return mcp.NewToolResultError(fmt.Sprintf("tool %q is not allowed for role %q", request.Params.Name, principal.Role)), nil
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// ToolFilter hides the tools the caller's role does not permit from tools/list
+func (a *Authenticator) ToolFilter() server.ToolFilterFunc {
+	return func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		principal := PrincipalFromContext(ctx)
+		if principal == nil {
+			return tools
+		}
+
+		allowed := []mcp.Tool{}
+		for _, tool := range tools {
+			if a.Allowed(principal.Role, tool.Name) {
+				allowed = append(allowed, tool)
+			}
+		}
+		return allowed
+	}
+}
+
+// NewTLSConfig - Build the TLS configuration for the http transport, or nil when TLS is not configured
+func NewTLSConfig(cfg *config.Config) (*tls.Config, error) {
+	if cfg.Server.TLSCertFile == "" && cfg.Server.TLSKeyFile == "" {
+		if cfg.Server.TLSClientCAFile != "" {
+			return nil, fmt.Errorf("client certificate verification requires tls_cert_file and tls_key_file")
+		}
+		return nil, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load TLS certificate: %v", err)
+	}
+
+	tlsConfig := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if cfg.Server.TLSClientCAFile != "" {
+		pem, err := os.ReadFile(cfg.Server.TLSClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read client CA file: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %s", cfg.Server.TLSClientCAFile)
+		}
+		tlsConfig.ClientCAs = pool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
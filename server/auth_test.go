@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestAuthConfig() *config.Config {
+	cfg := &config.Config{}
+	cfg.Auth.Roles = map[string][]string{
+		"reader": {"list_*", "desc_table", "read_query"},
+		"admin":  {"*"},
+	}
+	cfg.Auth.Tokens = []config.AuthToken{
+		{Name: "alice", Token: "reader-token", Role: "reader"},
+		{Name: "bob", Token: "admin-token", Role: "admin"},
+	}
+	cfg.Auth.ClientCertRoles = map[string]string{"ci-runner": "reader"}
+	return cfg
+}
+
+func TestAuthenticate(t *testing.T) {
+	auth, err := NewAuthenticator(newTestAuthConfig())
+	assert.NoError(t, err)
+	assert.True(t, auth.Enabled())
+
+	t.Run("valid bearer token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer admin-token")
+		principal, err := auth.Authenticate(req)
+		assert.NoError(t, err)
+		assert.Equal(t, &Principal{Name: "bob", Role: "admin"}, principal)
+	})
+
+	t.Run("invalid bearer token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer wrong")
+		_, err := auth.Authenticate(req)
+		assert.Error(t, err)
+	})
+
+	t.Run("unsupported scheme", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Basic YWxpY2U6cGFzcw==")
+		_, err := auth.Authenticate(req)
+		assert.Error(t, err)
+	})
+
+	t.Run("verified client certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{
+			{{Subject: pkix.Name{CommonName: "ci-runner"}}},
+		}}
+		principal, err := auth.Authenticate(req)
+		assert.NoError(t, err)
+		assert.Equal(t, &Principal{Name: "ci-runner", Role: "reader"}, principal)
+	})
+
+	t.Run("unmapped client certificate", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{
+			{{Subject: pkix.Name{CommonName: "stranger"}}},
+		}}
+		_, err := auth.Authenticate(req)
+		assert.Error(t, err)
+	})
+
+	t.Run("missing credentials", func(t *testing.T) {
+		_, err := auth.Authenticate(httptest.NewRequest(http.MethodPost, "/mcp", nil))
+		assert.Error(t, err)
+	})
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	auth, err := NewAuthenticator(newTestAuthConfig())
+	assert.NoError(t, err)
+
+	var seen *Principal
+	handler := auth.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = PrincipalFromContext(r.Context())
+	}))
+
+	t.Run("rejects before reaching the handler", func(t *testing.T) {
+		seen = nil
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", nil))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+		assert.Contains(t, rec.Header().Get("WWW-Authenticate"), "Bearer")
+		assert.Nil(t, seen)
+	})
+
+	t.Run("passes the principal on", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer reader-token")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "alice", seen.Name)
+	})
+}
+
+func TestAuthRoles(t *testing.T) {
+	auth, err := NewAuthenticator(newTestAuthConfig())
+	assert.NoError(t, err)
+
+	assert.True(t, auth.Allowed("reader", "list_table"))
+	assert.True(t, auth.Allowed("reader", "read_query"))
+	assert.False(t, auth.Allowed("reader", "write_query"))
+	assert.True(t, auth.Allowed("admin", "write_query"))
+	assert.False(t, auth.Allowed("unknown", "read_query"))
+
+	t.Run("tool middleware", func(t *testing.T) {
+		next := func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			return mcp.NewToolResultText("ok"), nil
+		}
+		handler := auth.ToolMiddleware()(next)
+
+		request := mcp.CallToolRequest{}
+		request.Params.Name = "write_query"
+
+		result, err := handler(WithPrincipal(context.Background(), &Principal{Name: "alice", Role: "reader"}), request)
+		assert.NoError(t, err)
+		assert.True(t, result.IsError)
+
+		result, err = handler(WithPrincipal(context.Background(), &Principal{Name: "bob", Role: "admin"}), request)
+		assert.NoError(t, err)
+		assert.False(t, result.IsError)
+
+		// stdio has no principal and is not restricted
+		result, err = handler(context.Background(), request)
+		assert.NoError(t, err)
+		assert.False(t, result.IsError)
+	})
+
+	t.Run("tool filter", func(t *testing.T) {
+		tools := []mcp.Tool{mcp.NewTool("list_table"), mcp.NewTool("write_query")}
+		ctx := WithPrincipal(context.Background(), &Principal{Name: "alice", Role: "reader"})
+
+		filtered := auth.ToolFilter()(ctx, tools)
+		assert.Len(t, filtered, 1)
+		assert.Equal(t, "list_table", filtered[0].Name)
+
+		assert.Len(t, auth.ToolFilter()(context.Background(), tools), 2)
+	})
+}
+
+func TestNewAuthenticator(t *testing.T) {
+	t.Run("undefined role", func(t *testing.T) {
+		cfg := newTestAuthConfig()
+		cfg.Auth.Tokens = append(cfg.Auth.Tokens, config.AuthToken{Name: "eve", Token: "x", Role: "root"})
+		_, err := NewAuthenticator(cfg)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `undefined role "root"`)
+	})
+
+	t.Run("token file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "tokens")
+		content := "# token role name\nfile-token reader carol\n\nanon-token admin\n"
+		assert.NoError(t, os.WriteFile(filename, []byte(content), 0o600))
+
+		cfg := newTestAuthConfig()
+		cfg.Auth.TokenFile = filename
+		auth, err := NewAuthenticator(cfg)
+		assert.NoError(t, err)
+
+		req := httptest.NewRequest(http.MethodPost, "/mcp", nil)
+		req.Header.Set("Authorization", "Bearer file-token")
+		principal, err := auth.Authenticate(req)
+		assert.NoError(t, err)
+		assert.Equal(t, &Principal{Name: "carol", Role: "reader"}, principal)
+
+		req.Header.Set("Authorization", "Bearer anon-token")
+		principal, err = auth.Authenticate(req)
+		assert.NoError(t, err)
+		assert.Equal(t, "admin", principal.Role)
+		assert.Contains(t, principal.Name, ":4")
+	})
+
+	t.Run("malformed token file", func(t *testing.T) {
+		filename := filepath.Join(t.TempDir(), "tokens")
+		assert.NoError(t, os.WriteFile(filename, []byte("only-a-token\n"), 0o600))
+
+		_, err := LoadTokenFile(filename)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "line 1")
+	})
+
+	t.Run("no methods configured", func(t *testing.T) {
+		auth, err := NewAuthenticator(&config.Config{})
+		assert.NoError(t, err)
+		assert.False(t, auth.Enabled())
+	})
+}
@@ -0,0 +1,178 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// cursor holds the unread rows of a truncated result for fetch_more. The rows are read
+// by the call that truncated the result, so no connection is held between calls
+type cursor struct {
+	mu sync.Mutex
+
+	// owner is the MCP session that opened the cursor
+	owner      string
+	connection string
+	columns    []ColumnInfo
+	// pending holds rows that were scanned but not yet returned
+	pending []map[string]interface{}
+	// more is set when the result had rows beyond the ones kept in pending
+	more  bool
+	timer *time.Timer
+}
+
+// CursorStore keeps the rest of truncated results so they can be continued with fetch_more
+type CursorStore struct {
+	idleTimeout time.Duration
+	maxOpen     int
+	maxRows     int
+
+	mu      sync.Mutex
+	cursors map[string]*cursor
+}
+
+// NewCursorStore - Create a cursor store. Cursors idle longer than idleTimeout are closed,
+// and each keeps at most maxRows rows. 0 means unlimited
+func NewCursorStore(idleTimeout time.Duration, maxOpen, maxRows int) *CursorStore {
+	return &CursorStore{
+		idleTimeout: idleTimeout,
+		maxOpen:     maxOpen,
+		maxRows:     maxRows,
+		cursors:     map[string]*cursor{},
+	}
+}
+
+// Open reads up to the cursor row limit of the unread rows and returns the token of a cursor holding them.
+// next is the row that was scanned past the limit of the first page. The cursor belongs to the MCP session owner
+func (s *CursorStore) Open(owner, connection string, rows *sqlx.Rows, scanner *rowScanner, next map[string]interface{}) (string, error) {
+	// next counts against the limit as well
+	rest := &QueryResult{Rows: []map[string]interface{}{next}}
+	beyond, err := scanner.scan(rows, s.maxRows, rest)
+	if err != nil {
+		return "", err
+	}
+	return s.add(&cursor{owner: owner, connection: connection, columns: scanner.columns, pending: rest.Rows, more: beyond != nil})
+}
+
+// Unread returns rows that were scanned but not shown to the cursor, so the next fetch starts with them.
+// An empty token creates a cursor of the MCP session owner that holds only these rows
+func (s *CursorStore) Unread(token, owner, connection string, columns []ColumnInfo, rows []map[string]interface{}) (string, error) {
+	if token == "" {
+		c := &cursor{owner: owner, connection: connection, columns: columns, pending: append([]map[string]interface{}{}, rows...)}
+		return s.add(c)
+	}
+
+	c, err := s.get(token, owner)
+	if err != nil {
+		return "", err
+	}
+	c.mu.Lock()
+	c.pending = append(append([]map[string]interface{}{}, rows...), c.pending...)
+	c.mu.Unlock()
+	return token, nil
+}
+
+// Fetch returns up to maxRows further rows of a cursor of the MCP session owner. The cursor is closed
+// once it is exhausted, otherwise the result carries the same token
+func (s *CursorStore) Fetch(token, owner string, maxRows int) (*QueryResult, error) {
+	c, err := s.get(token, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.timer.Reset(s.idleTimeout)
+
+	start := time.Now()
+	result := &QueryResult{Columns: c.columns, Rows: []map[string]interface{}{}, MaxRows: maxRows, connection: c.connection}
+	defer func() { result.Elapsed = time.Since(start) }()
+
+	take := len(c.pending)
+	if maxRows > 0 && take > maxRows {
+		take = maxRows
+	}
+	result.Rows = append(result.Rows, c.pending[:take]...)
+	c.pending = c.pending[take:]
+
+	switch {
+	case len(c.pending) > 0:
+		result.Truncated = true
+		result.Cursor = token
+	case c.more:
+		// The rows beyond the cursor row limit were never read
+		result.Truncated = true
+		result.cursorMaxRows = s.maxRows
+		s.Close(token)
+	default:
+		s.Close(token)
+	}
+
+	return result, nil
+}
+
+// Close forgets a cursor and its rows
+func (s *CursorStore) Close(token string) {
+	s.mu.Lock()
+	c, ok := s.cursors[token]
+	delete(s.cursors, token)
+	s.mu.Unlock()
+
+	if ok {
+		c.timer.Stop()
+	}
+}
+
+// CloseAll closes every open cursor
+func (s *CursorStore) CloseAll() {
+	s.mu.Lock()
+	tokens := make([]string, 0, len(s.cursors))
+	for token := range s.cursors {
+		tokens = append(tokens, token)
+	}
+	s.mu.Unlock()
+
+	for _, token := range tokens {
+		s.Close(token)
+	}
+}
+
+func (s *CursorStore) add(c *cursor) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.maxOpen > 0 && len(s.cursors) >= s.maxOpen {
+		return "", fmt.Errorf("too many open cursors (max %d)", s.maxOpen)
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate cursor token: %v", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	c.timer = time.AfterFunc(s.idleTimeout, func() {
+		zap.S().Debugw("closing idle cursor", "connection", c.connection)
+		s.Close(token)
+	})
+	s.cursors[token] = c
+	return token, nil
+}
+
+func (s *CursorStore) get(token, owner string) (*cursor, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.cursors[token]
+	// Cursors of other sessions are reported as missing, so their tokens cannot be probed
+	if !ok || c.owner != owner {
+		return nil, fmt.Errorf("cursor %q does not exist or has expired", token)
+	}
+	return c, nil
+}
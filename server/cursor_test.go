@@ -0,0 +1,138 @@
+package server
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestRows(n int) []map[string]interface{} {
+	rows := []map[string]interface{}{}
+	for i := 0; i < n; i++ {
+		rows = append(rows, map[string]interface{}{"id": i})
+	}
+	return rows
+}
+
+func TestCursorStore(t *testing.T) {
+	t.Run("pages through pending rows", func(t *testing.T) {
+		store := NewCursorStore(time.Minute, 0, 0)
+		token, err := store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(5))
+		assert.NoError(t, err)
+
+		result, err := store.Fetch(token, "", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, newTestRows(2), result.Rows)
+		assert.True(t, result.Truncated)
+		assert.Equal(t, token, result.Cursor)
+
+		result, err = store.Fetch(token, "", 2)
+		assert.NoError(t, err)
+		assert.Equal(t, 2, result.Rows[0]["id"])
+		assert.Equal(t, token, result.Cursor)
+
+		result, err = store.Fetch(token, "", 2)
+		assert.NoError(t, err)
+		assert.Len(t, result.Rows, 1)
+		assert.False(t, result.Truncated)
+		assert.Empty(t, result.Cursor)
+
+		// An exhausted cursor is gone
+		_, err = store.Fetch(token, "", 2)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not exist or has expired")
+	})
+
+	t.Run("unread rows come first", func(t *testing.T) {
+		store := NewCursorStore(time.Minute, 0, 0)
+		token, err := store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(3)[2:])
+		assert.NoError(t, err)
+
+		same, err := store.Unread(token, "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(2))
+		assert.NoError(t, err)
+		assert.Equal(t, token, same)
+
+		result, err := store.Fetch(token, "", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, newTestRows(3), result.Rows)
+	})
+
+	t.Run("expires when idle", func(t *testing.T) {
+		store := NewCursorStore(10*time.Millisecond, 0, 0)
+		token, err := store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(3))
+		assert.NoError(t, err)
+
+		assert.Eventually(t, func() bool {
+			_, err := store.Fetch(token, "", 1)
+			return err != nil
+		}, time.Second, 5*time.Millisecond)
+	})
+
+	t.Run("limits open cursors", func(t *testing.T) {
+		store := NewCursorStore(time.Minute, 1, 0)
+		_, err := store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(1))
+		assert.NoError(t, err)
+
+		_, err = store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(1))
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "too many open cursors")
+
+		store.CloseAll()
+		_, err = store.Unread("", "", "default", []ColumnInfo{{Name: "id"}}, newTestRows(1))
+		assert.NoError(t, err)
+	})
+
+	t.Run("cursors of other sessions are missing", func(t *testing.T) {
+		store := NewCursorStore(time.Minute, 0, 0)
+		token, err := store.Unread("", "session-a", "default", []ColumnInfo{{Name: "id"}}, newTestRows(3))
+		assert.NoError(t, err)
+
+		_, err = store.Fetch(token, "session-b", 1)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "does not exist or has expired")
+		_, err = store.Unread(token, "session-b", "default", []ColumnInfo{{Name: "id"}}, newTestRows(1))
+		assert.Error(t, err)
+
+		result, err := store.Fetch(token, "session-a", 0)
+		assert.NoError(t, err)
+		assert.Equal(t, newTestRows(3), result.Rows)
+	})
+
+	t.Run("stops at the cursor row limit", func(t *testing.T) {
+		store := NewCursorStore(time.Minute, 0, 2)
+		token, err := store.add(&cursor{connection: "default", columns: []ColumnInfo{{Name: "id"}}, pending: newTestRows(2), more: true})
+		assert.NoError(t, err)
+
+		result, err := store.Fetch(token, "", 10)
+		assert.NoError(t, err)
+		assert.Len(t, result.Rows, 2)
+		assert.True(t, result.Truncated)
+		assert.Empty(t, result.Cursor)
+
+		s, err := RenderResult(result, QueryOptions{})
+		assert.NoError(t, err)
+		assert.Contains(t, s, "the query has more rows than fetch_more keeps (cursor_max_rows=2)")
+	})
+}
+
+func TestRenderResultWithCursor(t *testing.T) {
+	store := NewCursorStore(time.Minute, 0, 0)
+	result := &QueryResult{Columns: []ColumnInfo{{Name: "id"}}, Rows: newTestRows(10)}
+
+	// The header is 3 bytes and each row 2 bytes, so only 3 rows fit
+	s, err := RenderResult(result, QueryOptions{MaxResultBytes: 9, Cursors: store})
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Cursor)
+	assert.Len(t, result.Rows, 3)
+	assert.Contains(t, s, "Call fetch_more with cursor")
+	assert.Contains(t, s, result.Cursor)
+
+	next, err := store.Fetch(result.Cursor, "", 100)
+	assert.NoError(t, err)
+	s, err = RenderResult(next, QueryOptions{Cursors: store})
+	assert.NoError(t, err)
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	assert.Equal(t, []string{"id", "3", "4", "5", "6", "7", "8", "9"}, lines)
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+const (
+	DDLOperationDrop   = "drop"
+	DDLOperationRename = "rename"
+	DDLOperationModify = "modify"
+)
+
+// ddlOperations classifies the ALTER TABLE operations that lose data or break existing queries.
+// Operations that are neither listed here nor in additiveOperations count as modify
+var ddlOperations = map[ast.AlterTableType]string{
+	ast.AlterTableDropColumn:                 DDLOperationDrop,
+	ast.AlterTableDropPrimaryKey:             DDLOperationDrop,
+	ast.AlterTableDropIndex:                  DDLOperationDrop,
+	ast.AlterTableDropForeignKey:             DDLOperationDrop,
+	ast.AlterTableDropCheck:                  DDLOperationDrop,
+	ast.AlterTableDropPartition:              DDLOperationDrop,
+	ast.AlterTableDropFirstPartition:         DDLOperationDrop,
+	ast.AlterTableTruncatePartition:          DDLOperationDrop,
+	ast.AlterTableDiscardTablespace:          DDLOperationDrop,
+	ast.AlterTableDiscardPartitionTablespace: DDLOperationDrop,
+	ast.AlterTableImportTablespace:           DDLOperationDrop,
+	ast.AlterTableImportPartitionTablespace:  DDLOperationDrop,
+	ast.AlterTableDropStatistics:             DDLOperationDrop,
+	ast.AlterTableRenameTable:                DDLOperationRename,
+	ast.AlterTableRenameColumn:               DDLOperationRename,
+	ast.AlterTableRenameIndex:                DDLOperationRename,
+	ast.AlterTableModifyColumn:               DDLOperationModify,
+	ast.AlterTableChangeColumn:               DDLOperationModify,
+	ast.AlterTableAlterColumn:                DDLOperationModify,
+	ast.AlterTableAlterCheck:                 DDLOperationModify,
+	ast.AlterTablePartition:                  DDLOperationModify,
+	ast.AlterTableRemovePartitioning:         DDLOperationModify,
+	ast.AlterTableCoalescePartitions:         DDLOperationModify,
+	ast.AlterTableReorganizePartition:        DDLOperationModify,
+	ast.AlterTableExchangePartition:          DDLOperationModify,
+	ast.AlterTableForce:                      DDLOperationModify,
+	ast.AlterTableReorganizeFirstPartition:   DDLOperationModify,
+	ast.AlterTableReorganizeLastPartition:    DDLOperationModify,
+	ast.AlterTableRebuildPartition:           DDLOperationModify,
+	ast.AlterTableIndexInvisible:             DDLOperationModify,
+	ast.AlterTableDisableKeys:                DDLOperationModify,
+	ast.AlterTableOrderByColumns:             DDLOperationModify,
+}
+
+// additiveOperations are the ALTER TABLE operations that only add to a table, choose how the
+// statement runs or are classified by their details. Operations the parser adds later are
+// not listed, so they are blocked until they are classified
+var additiveOperations = map[ast.AlterTableType]bool{
+	ast.AlterTableAddColumns:        true,
+	ast.AlterTableAddConstraint:     true,
+	ast.AlterTableAddPartitions:     true,
+	ast.AlterTableLock:              true,
+	ast.AlterTableAlgorithm:         true,
+	ast.AlterTableWithValidation:    true,
+	ast.AlterTableWithoutValidation: true,
+	ast.AlterTableOption:            true,
+}
+
+// DDLPolicy decides which operations create_table and alter_table may run
+type DDLPolicy struct {
+	AllowDrop   bool
+	AllowRename bool
+	AllowModify bool
+}
+
+// NewDDLPolicy - Create the DDL policy from the configuration
+func NewDDLPolicy(cfg *config.Config) DDLPolicy {
+	return DDLPolicy{
+		AllowDrop:   cfg.DDL.AllowDrop,
+		AllowRename: cfg.DDL.AllowRename,
+		AllowModify: cfg.DDL.AllowModify,
+	}
+}
+
+// allows reports whether an operation class is enabled
+func (p DDLPolicy) allows(operation string) bool {
+	switch operation {
+	case DDLOperationDrop:
+		return p.AllowDrop
+	case DDLOperationRename:
+		return p.AllowRename
+	case DDLOperationModify:
+		return p.AllowModify
+	default:
+		return true
+	}
+}
+
+// Check verifies that a CREATE TABLE or ALTER TABLE statement only runs allowed operations.
+// The error lists every blocked clause with the setting that allows it. Other statements pass
+func (p DDLPolicy) Check(stmt *Statement) error {
+	switch n := stmt.Node.(type) {
+	case *ast.CreateTableStmt:
+		// CREATE TABLE only adds a table; an existing one is never replaced
+		return nil
+	case *ast.AlterTableStmt:
+		blocked := []string{}
+		for _, spec := range n.Specs {
+			for _, operation := range alterOperations(spec) {
+				if !p.allows(operation) {
+					blocked = append(blocked, fmt.Sprintf("%s (%s, allowed by ddl.allow_%s)", restoreNode(spec), operation, operation))
+					break
+				}
+			}
+		}
+		if len(blocked) > 0 {
+			return fmt.Errorf("ALTER TABLE %s contains blocked operations: %s", restoreNode(n.Table), strings.Join(blocked, "; "))
+		}
+		return nil
+	default:
+		return nil
+	}
+}
+
+// alterOperations returns the operation classes of one ALTER TABLE clause
+func alterOperations(spec *ast.AlterTableSpec) []string {
+	operations := []string{}
+	if operation, ok := ddlOperations[spec.Tp]; ok {
+		operations = append(operations, operation)
+	} else if !additiveOperations[spec.Tp] {
+		operations = append(operations, DDLOperationModify)
+	}
+
+	switch spec.Tp {
+	case ast.AlterTableChangeColumn:
+		// CHANGE COLUMN also renames when the new name differs
+		if len(spec.NewColumns) > 0 && spec.OldColumnName != nil && !strings.EqualFold(spec.OldColumnName.Name.O, spec.NewColumns[0].Name.Name.O) {
+			operations = append(operations, DDLOperationRename)
+		}
+	case ast.AlterTableOption:
+		// Every table option but the comment changes how the table stores its rows: ENGINE=BLACKHOLE
+		// discards later writes, ROW_FORMAT and most others rebuild the table, AUTO_INCREMENT moves
+		// the next id and CONVERT TO CHARACTER SET rewrites every text column
+		for _, option := range spec.Options {
+			if option.Tp != ast.TableOptionComment {
+				operations = append(operations, DDLOperationModify)
+				break
+			}
+		}
+	}
+	return operations
+}
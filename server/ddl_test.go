@@ -0,0 +1,112 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDDLPolicy(t *testing.T) {
+	check := func(policy DDLPolicy, query string) error {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err, query) {
+			t.FailNow()
+		}
+		return policy.Check(stmt)
+	}
+
+	t.Run("additive statements pass", func(t *testing.T) {
+		for _, query := range []string{
+			"CREATE TABLE t (id INT PRIMARY KEY)",
+			"CREATE TABLE IF NOT EXISTS t2 LIKE t",
+			"ALTER TABLE t ADD COLUMN c INT COMMENT 'c'",
+			"ALTER TABLE t ADD INDEX idx_c (c), COMMENT = 'table'",
+			"ALTER TABLE t CHANGE COLUMN c c BIGINT",
+		} {
+			err := check(DDLPolicy{AllowModify: true}, query)
+			assert.NoError(t, err, query)
+		}
+	})
+
+	t.Run("blocked clauses are listed", func(t *testing.T) {
+		err := check(DDLPolicy{}, "ALTER TABLE users ADD COLUMN c INT, DROP COLUMN email, RENAME TO people, MODIFY COLUMN name TEXT")
+		assert.EqualError(t, err, "ALTER TABLE `users` contains blocked operations: "+
+			"DROP COLUMN `email` (drop, allowed by ddl.allow_drop); "+
+			"RENAME AS `people` (rename, allowed by ddl.allow_rename); "+
+			"MODIFY COLUMN `name` TEXT (modify, allowed by ddl.allow_modify)")
+	})
+
+	t.Run("allowed classes", func(t *testing.T) {
+		err := check(DDLPolicy{AllowDrop: true, AllowRename: true, AllowModify: true},
+			"ALTER TABLE users DROP COLUMN email, RENAME COLUMN a TO b, MODIFY COLUMN name TEXT")
+		assert.NoError(t, err)
+	})
+
+	t.Run("change column that renames", func(t *testing.T) {
+		err := check(DDLPolicy{AllowModify: true}, "ALTER TABLE t CHANGE COLUMN a b INT")
+		assert.ErrorContains(t, err, "(rename, allowed by ddl.allow_rename)")
+	})
+
+	t.Run("other drops and renames", func(t *testing.T) {
+		for _, query := range []string{
+			"ALTER TABLE t DROP INDEX idx",
+			"ALTER TABLE t DROP PRIMARY KEY",
+			"ALTER TABLE t DROP FOREIGN KEY fk",
+			"ALTER TABLE t TRUNCATE PARTITION p0",
+			"ALTER TABLE t RENAME INDEX a TO b",
+			"ALTER TABLE t CONVERT TO CHARACTER SET latin1",
+		} {
+			assert.ErrorContains(t, check(DDLPolicy{}, query), "contains blocked operations", query)
+		}
+	})
+
+	t.Run("table options", func(t *testing.T) {
+		for _, query := range []string{
+			"ALTER TABLE t ENGINE = BLACKHOLE",
+			"ALTER TABLE t ROW_FORMAT = COMPRESSED",
+			"ALTER TABLE t AUTO_INCREMENT = 1000",
+			"ALTER TABLE t DEFAULT CHARSET = latin1",
+			"ALTER TABLE t COMMENT = 'orders', ENGINE = MyISAM",
+			"ALTER TABLE t FORCE",
+		} {
+			assert.ErrorContains(t, check(DDLPolicy{}, query), "(modify, allowed by ddl.allow_modify)", query)
+		}
+		assert.NoError(t, check(DDLPolicy{}, "ALTER TABLE t COMMENT = 'orders'"))
+	})
+}
+
+func TestCheckWriteDDL(t *testing.T) {
+	// Statements of another kind never reach the policy: the statement check rejects them first
+	for _, query := range []string{"DROP TABLE t", "TRUNCATE TABLE t", "CREATE TABLE t (id INT); DROP TABLE u"} {
+		_, err := CheckStatement(query, StatementTypeCreateTable)
+		assert.Error(t, err, query)
+		_, err = CheckStatement(query, StatementTypeAlterTable)
+		assert.Error(t, err, query)
+	}
+
+	_, err := checkWrite("ALTER TABLE t DROP COLUMN c", WriteOptions{})
+	assert.ErrorContains(t, err, "DROP COLUMN `c` (drop, allowed by ddl.allow_drop)")
+
+	blocked := map[string]string{
+		"ALTER TABLE t IMPORT TABLESPACE":                                                 "(drop, allowed by ddl.allow_drop)",
+		"ALTER TABLE t IMPORT PARTITION p0 TABLESPACE":                                    "(drop, allowed by ddl.allow_drop)",
+		"ALTER TABLE t ALTER INDEX idx INVISIBLE":                                         "(modify, allowed by ddl.allow_modify)",
+		"ALTER TABLE t DISABLE KEYS":                                                      "(modify, allowed by ddl.allow_modify)",
+		"ALTER TABLE t REBUILD PARTITION p0":                                              "(modify, allowed by ddl.allow_modify)",
+		"ALTER TABLE t ORDER BY c":                                                        "(modify, allowed by ddl.allow_modify)",
+		"ALTER TABLE t REORGANIZE PARTITION p0 INTO (PARTITION p1 VALUES LESS THAN (10))": "(modify, allowed by ddl.allow_modify)",
+		"ALTER TABLE t ENABLE KEYS":                                                       "(modify, allowed by ddl.allow_modify)",
+	}
+	for query, message := range blocked {
+		_, err := checkWrite(query, WriteOptions{})
+		assert.ErrorContains(t, err, message, query)
+	}
+
+	for _, query := range []string{
+		"ALTER TABLE t ADD COLUMN c INT, ALGORITHM = INPLACE, LOCK = NONE",
+		"ALTER TABLE t ADD UNIQUE INDEX u (c)",
+	} {
+		_, err := checkWrite(query, WriteOptions{})
+		assert.NoError(t, err, query)
+	}
+}
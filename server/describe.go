@@ -0,0 +1,325 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TableDescription is the structured content of describe_table
+type TableDescription struct {
+	Connection string              `json:"connection"`
+	Database   string              `json:"database"`
+	Table      string              `json:"table"`
+	Columns    []ColumnDescription `json:"columns"`
+	Indexes    []IndexDescription  `json:"indexes"`
+	// ForeignKeys are the foreign keys of the table, ReferencedBy those of other tables that point to it
+	ForeignKeys      []ForeignKeyDescription `json:"foreign_keys"`
+	ReferencedBy     []ForeignKeyDescription `json:"referenced_by"`
+	CheckConstraints []CheckConstraint       `json:"check_constraints"`
+}
+
+// ColumnDescription is a column of a table, in table order
+type ColumnDescription struct {
+	Name string `json:"name"`
+	// Type is the full column type, such as varchar(255) or int unsigned
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Default is the default value as MySQL reports it, null when the column has none
+	Default *string `json:"default"`
+	// Key is PRI, UNI or MUL when the column is the first column of an index
+	Key string `json:"key,omitempty"`
+	// Extra holds attributes such as auto_increment or DEFAULT_GENERATED
+	Extra   string `json:"extra,omitempty"`
+	Comment string `json:"comment,omitempty"`
+	// Generated is the expression of a generated column
+	Generated string `json:"generated,omitempty"`
+}
+
+// IndexDescription is an index of a table. The primary key is named PRIMARY
+type IndexDescription struct {
+	Name string `json:"name"`
+	// Columns are the indexed columns in index order. Functional key parts are shown as (expression)
+	Columns []string `json:"columns"`
+	Unique  bool     `json:"unique"`
+	Type    string   `json:"type"`
+	// Cardinality is the estimated number of distinct values of the whole index, null when unknown
+	Cardinality *int64 `json:"cardinality"`
+}
+
+// ForeignKeyDescription is a foreign key from Table to ReferencedTable
+type ForeignKeyDescription struct {
+	Name               string   `json:"name"`
+	Database           string   `json:"database"`
+	Table              string   `json:"table"`
+	Columns            []string `json:"columns"`
+	ReferencedDatabase string   `json:"referenced_database"`
+	ReferencedTable    string   `json:"referenced_table"`
+	ReferencedColumns  []string `json:"referenced_columns"`
+	OnUpdate           string   `json:"on_update,omitempty"`
+	OnDelete           string   `json:"on_delete,omitempty"`
+}
+
+// CheckConstraint is a CHECK constraint of a table
+type CheckConstraint struct {
+	Name   string `json:"name"`
+	Clause string `json:"clause"`
+}
+
+// columnRow is a row of information_schema.COLUMNS
+type columnRow struct {
+	Name      string         `db:"name"`
+	Type      string         `db:"type"`
+	Nullable  string         `db:"nullable"`
+	Default   sql.NullString `db:"default_value"`
+	Key       string         `db:"column_key"`
+	Extra     string         `db:"extra"`
+	Comment   string         `db:"comment"`
+	Generated sql.NullString `db:"generated"`
+}
+
+// indexRow is a row of information_schema.STATISTICS, one per key part
+type indexRow struct {
+	Name        string         `db:"name"`
+	NonUnique   int            `db:"non_unique"`
+	Column      sql.NullString `db:"column_name"`
+	Cardinality sql.NullInt64  `db:"cardinality"`
+	Type        string         `db:"index_type"`
+}
+
+// foreignKeyRow is a row of information_schema.KEY_COLUMN_USAGE with the rules of its constraint
+type foreignKeyRow struct {
+	Name               string         `db:"name"`
+	Database           string         `db:"table_schema"`
+	Table              string         `db:"table_name"`
+	Column             string         `db:"column_name"`
+	ReferencedDatabase string         `db:"referenced_schema"`
+	ReferencedTable    string         `db:"referenced_table"`
+	ReferencedColumn   string         `db:"referenced_column"`
+	OnUpdate           sql.NullString `db:"on_update"`
+	OnDelete           sql.NullString `db:"on_delete"`
+}
+
+const (
+	describeColumnsQuery = `SELECT COLUMN_NAME AS name, COLUMN_TYPE AS type, IS_NULLABLE AS nullable,
+		COLUMN_DEFAULT AS default_value, COLUMN_KEY AS column_key, EXTRA AS extra,
+		COLUMN_COMMENT AS comment, GENERATION_EXPRESSION AS generated
+		FROM information_schema.COLUMNS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`
+
+	describeIndexesQuery = `SELECT INDEX_NAME AS name, NON_UNIQUE AS non_unique, COLUMN_NAME AS column_name,
+		CARDINALITY AS cardinality, INDEX_TYPE AS index_type
+		FROM information_schema.STATISTICS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?
+		ORDER BY INDEX_NAME <> 'PRIMARY', INDEX_NAME, SEQ_IN_INDEX`
+
+	describeForeignKeysQuery = `SELECT k.CONSTRAINT_NAME AS name, k.TABLE_SCHEMA AS table_schema, k.TABLE_NAME AS table_name,
+		k.COLUMN_NAME AS column_name, k.REFERENCED_TABLE_SCHEMA AS referenced_schema,
+		k.REFERENCED_TABLE_NAME AS referenced_table, k.REFERENCED_COLUMN_NAME AS referenced_column,
+		r.UPDATE_RULE AS on_update, r.DELETE_RULE AS on_delete
+		FROM information_schema.KEY_COLUMN_USAGE k
+		LEFT JOIN information_schema.REFERENTIAL_CONSTRAINTS r
+			ON r.CONSTRAINT_SCHEMA = k.CONSTRAINT_SCHEMA AND r.CONSTRAINT_NAME = k.CONSTRAINT_NAME AND r.TABLE_NAME = k.TABLE_NAME
+		WHERE k.REFERENCED_TABLE_NAME IS NOT NULL AND `
+
+	describeChecksQuery = `SELECT CONSTRAINT_NAME
+		FROM information_schema.TABLE_CONSTRAINTS
+		WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND CONSTRAINT_TYPE = 'CHECK'
+		ORDER BY CONSTRAINT_NAME`
+)
+
+// HandleDescribeTable describes the columns, indexes, foreign keys and check constraints of a table
+// from information_schema. name may be qualified with its database, otherwise it refers to database
+// or the connection's default database. Columns hidden by access rules are left out, together with
+// the indexes, foreign keys and checks that use them
+func HandleDescribeTable(ctx context.Context, conn *Connection, name, database string) (*TableDescription, error) {
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
+
+	table, err := ResolveTable(ctx, conn, name, database)
+	if err != nil {
+		return nil, err
+	}
+
+	db := conn.ReadDB
+	columns := []columnRow{}
+	if err := db.SelectContext(ctx, &columns, describeColumnsQuery, table.Schema, table.Table); err != nil {
+		return nil, statementError(ctx, err)
+	}
+	indexes := []indexRow{}
+	if err := db.SelectContext(ctx, &indexes, describeIndexesQuery, table.Schema, table.Table); err != nil {
+		return nil, statementError(ctx, err)
+	}
+	foreignKeys := []foreignKeyRow{}
+	if err := db.SelectContext(ctx, &foreignKeys, describeForeignKeysQuery+
+		"k.TABLE_SCHEMA = ? AND k.TABLE_NAME = ? ORDER BY k.CONSTRAINT_NAME, k.ORDINAL_POSITION", table.Schema, table.Table); err != nil {
+		return nil, statementError(ctx, err)
+	}
+	referencedBy := []foreignKeyRow{}
+	if err := db.SelectContext(ctx, &referencedBy, describeForeignKeysQuery+
+		"k.REFERENCED_TABLE_SCHEMA = ? AND k.REFERENCED_TABLE_NAME = ? ORDER BY k.TABLE_SCHEMA, k.TABLE_NAME, k.CONSTRAINT_NAME, k.ORDINAL_POSITION",
+		table.Schema, table.Table); err != nil {
+		return nil, statementError(ctx, err)
+	}
+	checks, err := checkConstraints(ctx, db, table)
+	if err != nil {
+		return nil, statementError(ctx, err)
+	}
+
+	description := buildTableDescription(conn.Access, table, columns, indexes, foreignKeys, referencedBy, checks)
+	description.Connection = conn.Name
+	return description, nil
+}
+
+// checkConstraints reads the check constraints of a table. Their clauses are only looked up when
+// the table has any, as information_schema.CHECK_CONSTRAINTS is missing before MySQL 8.0.16
+func checkConstraints(ctx context.Context, db *sqlx.DB, table TableName) ([]CheckConstraint, error) {
+	names := []string{}
+	if err := db.SelectContext(ctx, &names, describeChecksQuery, table.Schema, table.Table); err != nil {
+		return nil, err
+	}
+	if len(names) == 0 {
+		return []CheckConstraint{}, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT CONSTRAINT_NAME AS name, CHECK_CLAUSE AS clause
+		FROM information_schema.CHECK_CONSTRAINTS
+		WHERE CONSTRAINT_SCHEMA = ? AND CONSTRAINT_NAME IN (?)
+		ORDER BY CONSTRAINT_NAME`, table.Schema, names)
+	if err != nil {
+		return nil, err
+	}
+	checks := []CheckConstraint{}
+	if err := db.SelectContext(ctx, &checks, query, args...); err != nil {
+		return nil, err
+	}
+	return checks, nil
+}
+
+// buildTableDescription assembles the rows read from information_schema, leaving out what access hides
+func buildTableDescription(access *AccessPolicy, table TableName, columns []columnRow, indexes []indexRow,
+	foreignKeys, referencedBy []foreignKeyRow, checks []CheckConstraint) *TableDescription {
+	d := &TableDescription{
+		Database:         table.Schema,
+		Table:            table.Table,
+		Columns:          []ColumnDescription{},
+		Indexes:          []IndexDescription{},
+		ForeignKeys:      []ForeignKeyDescription{},
+		ReferencedBy:     []ForeignKeyDescription{},
+		CheckConstraints: []CheckConstraint{},
+	}
+
+	hidden := []string{}
+	for _, col := range columns {
+		if !access.ColumnAllowed(table.Schema, table.Table, col.Name) {
+			hidden = append(hidden, col.Name)
+			continue
+		}
+		c := ColumnDescription{
+			Name:      col.Name,
+			Type:      col.Type,
+			Nullable:  col.Nullable == "YES",
+			Key:       col.Key,
+			Extra:     col.Extra,
+			Comment:   col.Comment,
+			Generated: col.Generated.String,
+		}
+		if col.Default.Valid {
+			c.Default = &col.Default.String
+		}
+		d.Columns = append(d.Columns, c)
+	}
+
+	for i := 0; i < len(indexes); {
+		index := IndexDescription{Name: indexes[i].Name, Columns: []string{}, Unique: indexes[i].NonUnique == 0, Type: indexes[i].Type}
+		visible := true
+		for ; i < len(indexes) && indexes[i].Name == index.Name; i++ {
+			column := "(expression)"
+			if indexes[i].Column.Valid {
+				column = indexes[i].Column.String
+				visible = visible && access.ColumnAllowed(table.Schema, table.Table, column)
+			}
+			index.Columns = append(index.Columns, column)
+			// The cardinality of the last key part counts the distinct values of the whole index
+			index.Cardinality = nil
+			if indexes[i].Cardinality.Valid {
+				cardinality := indexes[i].Cardinality.Int64
+				index.Cardinality = &cardinality
+			}
+		}
+		if visible {
+			d.Indexes = append(d.Indexes, index)
+		}
+	}
+
+	for _, fk := range groupForeignKeys(foreignKeys) {
+		if foreignKeyVisible(access, fk) {
+			d.ForeignKeys = append(d.ForeignKeys, fk)
+		}
+	}
+	for _, fk := range groupForeignKeys(referencedBy) {
+		if foreignKeyVisible(access, fk) {
+			d.ReferencedBy = append(d.ReferencedBy, fk)
+		}
+	}
+
+	for _, check := range checks {
+		if !mentionsColumn(check.Clause, hidden) {
+			d.CheckConstraints = append(d.CheckConstraints, check)
+		}
+	}
+	return d
+}
+
+// groupForeignKeys merges the rows of each foreign key, which come one per column in key order
+func groupForeignKeys(rows []foreignKeyRow) []ForeignKeyDescription {
+	keys := []ForeignKeyDescription{}
+	for i, row := range rows {
+		if i == 0 || row.Name != rows[i-1].Name || row.Database != rows[i-1].Database || row.Table != rows[i-1].Table {
+			keys = append(keys, ForeignKeyDescription{
+				Name:               row.Name,
+				Database:           row.Database,
+				Table:              row.Table,
+				Columns:            []string{},
+				ReferencedDatabase: row.ReferencedDatabase,
+				ReferencedTable:    row.ReferencedTable,
+				ReferencedColumns:  []string{},
+				OnUpdate:           row.OnUpdate.String,
+				OnDelete:           row.OnDelete.String,
+			})
+		}
+		fk := &keys[len(keys)-1]
+		fk.Columns = append(fk.Columns, row.Column)
+		fk.ReferencedColumns = append(fk.ReferencedColumns, row.ReferencedColumn)
+	}
+	return keys
+}
+
+// foreignKeyVisible reports whether access shows both tables of a foreign key and all of its columns
+func foreignKeyVisible(access *AccessPolicy, fk ForeignKeyDescription) bool {
+	for _, col := range fk.Columns {
+		if !access.ColumnAllowed(fk.Database, fk.Table, col) {
+			return false
+		}
+	}
+	for _, col := range fk.ReferencedColumns {
+		if !access.ColumnAllowed(fk.ReferencedDatabase, fk.ReferencedTable, col) {
+			return false
+		}
+	}
+	return true
+}
+
+// mentionsColumn reports whether a check clause refers to one of the columns, which MySQL writes quoted
+func mentionsColumn(clause string, columns []string) bool {
+	clause = strings.ToLower(clause)
+	for _, col := range columns {
+		if strings.Contains(clause, strings.ToLower(quoteIdentifier(col))) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildTableDescription(t *testing.T) {
+	table := TableName{Schema: "shop", Table: "orders"}
+	columns := []columnRow{
+		{Name: "id", Type: "bigint unsigned", Nullable: "NO", Key: "PRI", Extra: "auto_increment"},
+		{Name: "customer_id", Type: "bigint unsigned", Nullable: "NO", Key: "MUL"},
+		{Name: "total", Type: "decimal(10,2)", Nullable: "NO", Default: sql.NullString{String: "0.00", Valid: true}, Comment: "Total in EUR"},
+		{Name: "note", Type: "text", Nullable: "YES"},
+		{Name: "total_cents", Type: "bigint", Nullable: "YES", Extra: "VIRTUAL GENERATED", Generated: sql.NullString{String: "(`total` * 100)", Valid: true}},
+	}
+	indexes := []indexRow{
+		{Name: "PRIMARY", Column: sql.NullString{String: "id", Valid: true}, Cardinality: sql.NullInt64{Int64: 1200, Valid: true}, Type: "BTREE"},
+		{Name: "customer_total", NonUnique: 1, Column: sql.NullString{String: "customer_id", Valid: true}, Cardinality: sql.NullInt64{Int64: 300, Valid: true}, Type: "BTREE"},
+		{Name: "customer_total", NonUnique: 1, Column: sql.NullString{String: "total", Valid: true}, Cardinality: sql.NullInt64{Int64: 1100, Valid: true}, Type: "BTREE"},
+		{Name: "lower_note", NonUnique: 1, Type: "BTREE"},
+		{Name: "note_prefix", NonUnique: 1, Column: sql.NullString{String: "note", Valid: true}, Type: "BTREE"},
+	}
+	foreignKeys := []foreignKeyRow{
+		{Name: "orders_customer", Database: "shop", Table: "orders", Column: "customer_id", ReferencedDatabase: "shop", ReferencedTable: "customers", ReferencedColumn: "id",
+			OnUpdate: sql.NullString{String: "RESTRICT", Valid: true}, OnDelete: sql.NullString{String: "CASCADE", Valid: true}},
+	}
+	referencedBy := []foreignKeyRow{
+		{Name: "items_order", Database: "shop", Table: "order_items", Column: "order_id", ReferencedDatabase: "shop", ReferencedTable: "orders", ReferencedColumn: "id"},
+		{Name: "audit_order", Database: "shop", Table: "secret_audit", Column: "order_id", ReferencedDatabase: "shop", ReferencedTable: "orders", ReferencedColumn: "id"},
+	}
+	checks := []CheckConstraint{
+		{Name: "total_positive", Clause: "(`total` >= 0)"},
+		{Name: "note_short", Clause: "(char_length(`note`) < 1000)"},
+	}
+
+	t.Run("everything visible", func(t *testing.T) {
+		d := buildTableDescription(nil, table, columns, indexes, foreignKeys, referencedBy, checks)
+
+		assert.Equal(t, "shop", d.Database)
+		assert.Equal(t, "orders", d.Table)
+		if assert.Len(t, d.Columns, 5) {
+			assert.Equal(t, ColumnDescription{Name: "id", Type: "bigint unsigned", Key: "PRI", Extra: "auto_increment"}, d.Columns[0])
+			assert.Equal(t, "0.00", *d.Columns[2].Default)
+			assert.Equal(t, "Total in EUR", d.Columns[2].Comment)
+			assert.True(t, d.Columns[3].Nullable)
+			assert.Nil(t, d.Columns[3].Default)
+			assert.Equal(t, "(`total` * 100)", d.Columns[4].Generated)
+		}
+
+		cardinality := func(n int64) *int64 { return &n }
+		assert.Equal(t, []IndexDescription{
+			{Name: "PRIMARY", Columns: []string{"id"}, Unique: true, Type: "BTREE", Cardinality: cardinality(1200)},
+			{Name: "customer_total", Columns: []string{"customer_id", "total"}, Type: "BTREE", Cardinality: cardinality(1100)},
+			{Name: "lower_note", Columns: []string{"(expression)"}, Type: "BTREE"},
+			{Name: "note_prefix", Columns: []string{"note"}, Type: "BTREE"},
+		}, d.Indexes)
+
+		assert.Equal(t, []ForeignKeyDescription{{
+			Name: "orders_customer", Database: "shop", Table: "orders", Columns: []string{"customer_id"},
+			ReferencedDatabase: "shop", ReferencedTable: "customers", ReferencedColumns: []string{"id"},
+			OnUpdate: "RESTRICT", OnDelete: "CASCADE",
+		}}, d.ForeignKeys)
+		assert.Len(t, d.ReferencedBy, 2)
+		assert.Equal(t, checks, d.CheckConstraints)
+	})
+
+	t.Run("hidden by access rules", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Access.Rules = []config.AccessRule{
+			{Action: AccessDeny, Table: "orders", Column: "note"},
+			{Action: AccessDeny, Table: "secret_*"},
+		}
+		access, err := NewAccessPolicy(cfg)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		d := buildTableDescription(access, table, columns, indexes, foreignKeys, referencedBy, checks)
+
+		names := []string{}
+		for _, col := range d.Columns {
+			names = append(names, col.Name)
+		}
+		assert.Equal(t, []string{"id", "customer_id", "total", "total_cents"}, names)
+		assert.Len(t, d.Indexes, 3)
+		assert.Len(t, d.ForeignKeys, 1)
+		if assert.Len(t, d.ReferencedBy, 1) {
+			assert.Equal(t, "order_items", d.ReferencedBy[0].Table)
+		}
+		assert.Equal(t, []CheckConstraint{{Name: "total_positive", Clause: "(`total` >= 0)"}}, d.CheckConstraints)
+	})
+}
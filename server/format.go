@@ -0,0 +1,239 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	FormatCSV      = "csv"
+	FormatTSV      = "tsv"
+	FormatJSON     = "json"
+	FormatJSONL    = "jsonl"
+	FormatMarkdown = "markdown"
+)
+
+// Formatter renders the rows of a read as tool output text
+type Formatter interface {
+	// Format renders the rows with their values in the order of cols
+	Format(cols []string, rows []map[string]interface{}) (string, error)
+}
+
+// FormatOptions configures the formatters
+type FormatOptions struct {
+	// NullValue is written for NULL in text formats. JSON formats always use null
+	NullValue string
+}
+
+// formatters creates the available output formats by name
+var formatters = map[string]func(opts FormatOptions) Formatter{
+	FormatCSV:      func(opts FormatOptions) Formatter { return csvFormatter{nullValue: opts.NullValue} },
+	FormatTSV:      func(opts FormatOptions) Formatter { return tsvFormatter{nullValue: opts.NullValue} },
+	FormatJSON:     func(opts FormatOptions) Formatter { return jsonFormatter{} },
+	FormatJSONL:    func(opts FormatOptions) Formatter { return jsonlFormatter{} },
+	FormatMarkdown: func(opts FormatOptions) Formatter { return markdownFormatter{nullValue: opts.NullValue} },
+}
+
+// FormatNames returns the names of all output formats in sorted order
+func FormatNames() []string {
+	names := make([]string, 0, len(formatters))
+	for name := range formatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetFormatter returns the formatter for an output format name. An empty name selects CSV
+func GetFormatter(name string, opts FormatOptions) (Formatter, error) {
+	if name == "" {
+		name = FormatCSV
+	}
+	newFormatter, ok := formatters[strings.ToLower(name)]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q, available formats: %s", name, strings.Join(FormatNames(), ", "))
+	}
+	return newFormatter(opts), nil
+}
+
+// formatCell renders a value as a single text cell
+func formatCell(v interface{}, nullValue string) string {
+	if v == nil {
+		return nullValue
+	}
+	return fmt.Sprintf("%v", v)
+}
+
+type csvFormatter struct {
+	nullValue string
+}
+
+func (f csvFormatter) Format(cols []string, rows []map[string]interface{}) (string, error) {
+	var csvBuf strings.Builder
+	writer := csv.NewWriter(&csvBuf)
+
+	if err := writer.Write(cols); err != nil {
+		return "", fmt.Errorf("failed to write headers: %v", err)
+	}
+
+	for _, row := range rows {
+		cells, err := rowCells(cols, row, f.nullValue)
+		if err != nil {
+			return "", err
+		}
+		if err := writer.Write(cells); err != nil {
+			return "", fmt.Errorf("failed to write row: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return "", fmt.Errorf("error flushing CSV writer: %v", err)
+	}
+
+	return csvBuf.String(), nil
+}
+
+// tsvFormatter writes one line per row with tab, newline and backslash escaped as in mysql --batch output
+type tsvFormatter struct {
+	nullValue string
+}
+
+var tsvEscaper = strings.NewReplacer("\\", "\\\\", "\t", "\\t", "\n", "\\n", "\r", "\\r")
+
+func (f tsvFormatter) Format(cols []string, rows []map[string]interface{}) (string, error) {
+	var b strings.Builder
+	writeLine := func(cells []string) {
+		for i, cell := range cells {
+			if i > 0 {
+				b.WriteByte('\t')
+			}
+			b.WriteString(tsvEscaper.Replace(cell))
+		}
+		b.WriteByte('\n')
+	}
+
+	writeLine(cols)
+	for _, row := range rows {
+		cells, err := rowCells(cols, row, f.nullValue)
+		if err != nil {
+			return "", err
+		}
+		writeLine(cells)
+	}
+	return b.String(), nil
+}
+
+// jsonFormatter writes an array of objects whose keys keep the column order
+type jsonFormatter struct{}
+
+func (jsonFormatter) Format(cols []string, rows []map[string]interface{}) (string, error) {
+	var b strings.Builder
+	b.WriteString("[")
+	for i, row := range rows {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n  ")
+		if err := writeJSONObject(&b, cols, row); err != nil {
+			return "", err
+		}
+	}
+	if len(rows) > 0 {
+		b.WriteString("\n")
+	}
+	b.WriteString("]\n")
+	return b.String(), nil
+}
+
+// jsonlFormatter writes one JSON object per line
+type jsonlFormatter struct{}
+
+func (jsonlFormatter) Format(cols []string, rows []map[string]interface{}) (string, error) {
+	var b strings.Builder
+	for _, row := range rows {
+		if err := writeJSONObject(&b, cols, row); err != nil {
+			return "", err
+		}
+		b.WriteString("\n")
+	}
+	return b.String(), nil
+}
+
+// markdownFormatter writes a GitHub-flavored Markdown table
+type markdownFormatter struct {
+	nullValue string
+}
+
+var markdownEscaper = strings.NewReplacer("\\", "\\\\", "|", "\\|", "\r\n", "<br>", "\n", "<br>", "\r", "<br>")
+
+func (f markdownFormatter) Format(cols []string, rows []map[string]interface{}) (string, error) {
+	var b strings.Builder
+	writeLine := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" ")
+			b.WriteString(markdownEscaper.Replace(cell))
+			b.WriteString(" |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeLine(cols)
+	b.WriteString("|")
+	for range cols {
+		b.WriteString(" --- |")
+	}
+	b.WriteString("\n")
+	for _, row := range rows {
+		cells, err := rowCells(cols, row, f.nullValue)
+		if err != nil {
+			return "", err
+		}
+		writeLine(cells)
+	}
+	return b.String(), nil
+}
+
+// rowCells returns the text cells of a row in column order
+func rowCells(cols []string, row map[string]interface{}, nullValue string) ([]string, error) {
+	cells := make([]string, len(cols))
+	for i, col := range cols {
+		value, exists := row[col]
+		if !exists {
+			return nil, fmt.Errorf("key '%s' not found in map", col)
+		}
+		cells[i] = formatCell(value, nullValue)
+	}
+	return cells, nil
+}
+
+// writeJSONObject writes a row as a JSON object. encoding/json sorts map keys, so the object is built by hand
+func writeJSONObject(b *strings.Builder, cols []string, row map[string]interface{}) error {
+	b.WriteString("{")
+	for i, col := range cols {
+		value, exists := row[col]
+		if !exists {
+			return fmt.Errorf("key '%s' not found in map", col)
+		}
+		key, err := json.Marshal(col)
+		if err != nil {
+			return err
+		}
+		val, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("failed to encode column %s: %v", col, err)
+		}
+		if i > 0 {
+			b.WriteString(",")
+		}
+		b.Write(key)
+		b.WriteString(":")
+		b.Write(val)
+	}
+	b.WriteString("}")
+	return nil
+}
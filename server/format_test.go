@@ -0,0 +1,89 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormatters(t *testing.T) {
+	cols := []string{"id", "name"}
+	rows := []map[string]interface{}{
+		{"id": 1, "name": "a,b"},
+		{"id": 2, "name": "x|y\tz\nw"},
+	}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{FormatCSV, "id,name\n1,\"a,b\"\n2,\"x|y\tz\nw\"\n"},
+		{FormatTSV, "id\tname\n1\ta,b\n2\tx|y\\tz\\nw\n"},
+		{FormatJSON, "[\n  {\"id\":1,\"name\":\"a,b\"},\n  {\"id\":2,\"name\":\"x|y\\tz\\nw\"}\n]\n"},
+		{FormatJSONL, "{\"id\":1,\"name\":\"a,b\"}\n{\"id\":2,\"name\":\"x|y\\tz\\nw\"}\n"},
+		{FormatMarkdown, "| id | name |\n| --- | --- |\n| 1 | a,b |\n| 2 | x\\|y\tz<br>w |\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			f, err := GetFormatter(tt.format, FormatOptions{NullValue: DefaultNullValue})
+			assert.NoError(t, err)
+			s, err := f.Format(cols, rows)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, s)
+		})
+	}
+
+	t.Run("JSON keeps column order and NULL", func(t *testing.T) {
+		f, _ := GetFormatter(FormatJSONL, FormatOptions{})
+		s, err := f.Format([]string{"z", "a"}, []map[string]interface{}{{"z": nil, "a": "v"}})
+		assert.NoError(t, err)
+		assert.Equal(t, "{\"z\":null,\"a\":\"v\"}\n", s)
+	})
+
+	t.Run("NULL token in text formats", func(t *testing.T) {
+		nullRows := []map[string]interface{}{{"id": 1, "name": nil}}
+		for _, name := range []string{FormatCSV, FormatTSV, FormatMarkdown} {
+			f, _ := GetFormatter(name, FormatOptions{NullValue: `\N`})
+			s, err := f.Format(cols, nullRows)
+			assert.NoError(t, err)
+			assert.Contains(t, s, `\N`, name)
+			assert.NotContains(t, s, "<nil>", name)
+		}
+	})
+
+	t.Run("empty JSON result", func(t *testing.T) {
+		f, _ := GetFormatter(FormatJSON, FormatOptions{})
+		s, err := f.Format(cols, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "[]\n", s)
+	})
+
+	t.Run("missing column", func(t *testing.T) {
+		for _, name := range FormatNames() {
+			f, _ := GetFormatter(name, FormatOptions{})
+			_, err := f.Format([]string{"missing"}, rows)
+			assert.Error(t, err, name)
+		}
+	})
+}
+
+func TestGetFormatter(t *testing.T) {
+	t.Run("empty name is CSV", func(t *testing.T) {
+		f, err := GetFormatter("", FormatOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, csvFormatter{}, f)
+	})
+
+	t.Run("case insensitive", func(t *testing.T) {
+		f, err := GetFormatter("JSON", FormatOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, jsonFormatter{}, f)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := GetFormatter("xml", FormatOptions{})
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "csv, json, jsonl, markdown, tsv")
+	})
+}
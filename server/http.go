@@ -0,0 +1,120 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"os/signal"
+	"path"
+	"syscall"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/cockroachdb/errors"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+)
+
+// shutdownTimeout bounds how long open HTTP and SSE streams may delay shutdown
+const shutdownTimeout = 5 * time.Second
+
+// HTTPEndpoints holds the paths the HTTP transport is mounted on
+type HTTPEndpoints struct {
+	StreamableHTTP string
+	SSE            string
+	Message        string
+}
+
+// NewHTTPHandler - Build a handler serving Streamable HTTP at <base>/mcp and legacy SSE at <base>/sse and <base>/message.
+// Every request must authenticate with auth. Without any authentication method the handler is refused
+// unless auth.allow_anonymous is set
+func NewHTTPHandler(mcpServer *server.MCPServer, basePath string, httpServer *http.Server, auth *Authenticator) (http.Handler, *server.SSEServer, HTTPEndpoints, error) {
+	if !auth.Enabled() && !auth.allowAnonymous {
+		return nil, nil, HTTPEndpoints{}, errors.New("the http transport requires authentication: configure auth.tokens, auth.token_file or auth.client_cert_roles, or set auth.allow_anonymous to serve every tool without it")
+	}
+	basePath = path.Join("/", basePath)
+
+	sseServer := server.NewSSEServer(mcpServer,
+		server.WithStaticBasePath(basePath),
+		server.WithHTTPServer(httpServer),
+	)
+	streamableServer := server.NewStreamableHTTPServer(mcpServer,
+		server.WithStreamableHTTPServer(httpServer),
+	)
+
+	endpoints := HTTPEndpoints{
+		StreamableHTTP: path.Join(basePath, "mcp"),
+		SSE:            sseServer.CompleteSsePath(),
+		Message:        sseServer.CompleteMessagePath(),
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(endpoints.StreamableHTTP, streamableServer)
+	mux.Handle(endpoints.SSE, sseServer)
+	mux.Handle(endpoints.Message, sseServer)
+
+	if !auth.Enabled() {
+		zap.S().Warnw("http transport is running without authentication, anyone who can reach it can call every tool")
+		return mux, sseServer, endpoints, nil
+	}
+	return auth.Middleware(mux), sseServer, endpoints, nil
+}
+
+// ServeHTTP - Serve the MCP server over HTTP until SIGINT or SIGTERM is received
+func ServeHTTP(mcpServer *server.MCPServer, cfg *config.Config, auth *Authenticator) error {
+	tlsConfig, err := NewTLSConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	httpServer := &http.Server{Addr: cfg.Server.Addr, TLSConfig: tlsConfig}
+	handler, sseServer, endpoints, err := NewHTTPHandler(mcpServer, cfg.Server.BasePath, httpServer, auth)
+	if err != nil {
+		return err
+	}
+	httpServer.Handler = handler
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		zap.S().Infow("listening for HTTP connections",
+			"addr", cfg.Server.Addr,
+			"streamable_http", endpoints.StreamableHTTP,
+			"sse", endpoints.SSE,
+			"message", endpoints.Message,
+			"tls", tlsConfig != nil,
+		)
+		if tlsConfig != nil {
+			// Certificates are already loaded into TLSConfig
+			errCh <- httpServer.ListenAndServeTLS("", "")
+			return
+		}
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		if !errors.Is(err, http.ErrServerClosed) {
+			return errors.Wrap(err, "failed to serve HTTP")
+		}
+		return nil
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	// Closing the SSE sessions first lets their streams end before the listener shuts down
+	if err := sseServer.Shutdown(shutdownCtx); err != nil {
+		zap.S().Warnw("HTTP server did not shut down cleanly", "error", err)
+		return httpServer.Close()
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewHTTPHandler(t *testing.T) {
+	mcpServer := server.NewMCPServer("mcp-mysql", "test")
+	anonymous := &Authenticator{allowAnonymous: true}
+
+	t.Run("endpoints under base path", func(t *testing.T) {
+		_, _, endpoints, _ := NewHTTPHandler(mcpServer, "/db/", &http.Server{}, anonymous)
+		assert.Equal(t, "/db/mcp", endpoints.StreamableHTTP)
+		assert.Equal(t, "/db/sse", endpoints.SSE)
+		assert.Equal(t, "/db/message", endpoints.Message)
+	})
+
+	t.Run("endpoints at root", func(t *testing.T) {
+		_, _, endpoints, _ := NewHTTPHandler(mcpServer, "", &http.Server{}, anonymous)
+		assert.Equal(t, "/mcp", endpoints.StreamableHTTP)
+		assert.Equal(t, "/sse", endpoints.SSE)
+		assert.Equal(t, "/message", endpoints.Message)
+	})
+
+	t.Run("streamable HTTP initialize", func(t *testing.T) {
+		handler, _, _, _ := NewHTTPHandler(mcpServer, "/", &http.Server{}, anonymous)
+		body := `{"jsonrpc":"2.0","id":1,"method":"initialize","params":{"protocolVersion":"2025-03-26","capabilities":{},"clientInfo":{"name":"test","version":"1.0"}}}`
+		req := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		rec := httptest.NewRecorder()
+
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"name":"mcp-mysql"`)
+	})
+
+	t.Run("refused without authentication", func(t *testing.T) {
+		_, _, _, err := NewHTTPHandler(mcpServer, "/", &http.Server{}, &Authenticator{})
+		assert.ErrorContains(t, err, "the http transport requires authentication")
+	})
+
+	t.Run("requests are authenticated", func(t *testing.T) {
+		auth := &Authenticator{tokens: []config.AuthToken{{Name: "alice", Token: "secret", Role: "admin"}}}
+		handler, _, _, err := NewHTTPHandler(mcpServer, "/", &http.Server{}, auth)
+		assert.NoError(t, err)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader("{}")))
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+
+	t.Run("unknown path", func(t *testing.T) {
+		handler, _, _, _ := NewHTTPHandler(mcpServer, "/", &http.Server{}, anonymous)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/other", nil))
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
@@ -0,0 +1,185 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// maxIdentifierLength is the longest database or table name MySQL accepts, in characters
+const maxIdentifierLength = 64
+
+// TableName is a table name, optionally qualified with its database
+type TableName struct {
+	Schema string
+	Table  string
+}
+
+// ParseTableName - Parse a table name given as table or database.table. Each part may be quoted in
+// backticks, with a doubled backtick standing for one, and must be quoted unless it only holds
+// letters, digits, $ and _. The parts are returned unquoted
+func ParseTableName(name string) (TableName, error) {
+	parts := []string{}
+	rest := strings.TrimSpace(name)
+	for {
+		part, n, err := parseIdentifier(rest)
+		if err != nil {
+			return TableName{}, fmt.Errorf("invalid table name %q: %v", name, err)
+		}
+		parts = append(parts, part)
+		rest = rest[n:]
+		if rest == "" {
+			break
+		}
+		if rest[0] != '.' {
+			return TableName{}, fmt.Errorf("invalid table name %q: unexpected %q after %s", name, rest, quoteIdentifier(part))
+		}
+		rest = rest[1:]
+	}
+
+	switch len(parts) {
+	case 1:
+		return TableName{Table: parts[0]}, nil
+	case 2:
+		return TableName{Schema: parts[0], Table: parts[1]}, nil
+	default:
+		return TableName{}, fmt.Errorf("invalid table name %q: expected table or database.table, quote names that contain a dot in backticks", name)
+	}
+}
+
+// ParseIdentifier - Parse a single database or table name, which may be quoted in backticks
+func ParseIdentifier(name string) (string, error) {
+	trimmed := strings.TrimSpace(name)
+	part, n, err := parseIdentifier(trimmed)
+	if err == nil && n < len(trimmed) {
+		err = fmt.Errorf("unexpected %q after %s", trimmed[n:], quoteIdentifier(part))
+	}
+	if err != nil {
+		return "", fmt.Errorf("invalid name %q: %v", name, err)
+	}
+	return part, nil
+}
+
+// parseIdentifier reads one quoted or unquoted name from the start of s and returns it with the bytes it used
+func parseIdentifier(s string) (string, int, error) {
+	var b strings.Builder
+	i := 0
+	if strings.HasPrefix(s, "`") {
+		i++
+		for {
+			end := strings.IndexByte(s[i:], '`')
+			if end < 0 {
+				return "", 0, fmt.Errorf("missing closing backtick")
+			}
+			b.WriteString(s[i : i+end])
+			i += end + 1
+			if !strings.HasPrefix(s[i:], "`") {
+				break
+			}
+			// A doubled backtick is a backtick of the name
+			b.WriteByte('`')
+			i++
+		}
+	} else {
+		for i < len(s) && s[i] != '.' {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			if !unquotedIdentifierRune(r) {
+				return "", 0, fmt.Errorf("%q is only allowed in names quoted in backticks", r)
+			}
+			b.WriteRune(r)
+			i += size
+		}
+	}
+
+	name := b.String()
+	if err := validateIdentifier(name); err != nil {
+		return "", 0, err
+	}
+	return name, i, nil
+}
+
+// unquotedIdentifierRune reports whether r may appear in a name without backticks
+func unquotedIdentifierRune(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '$', r == '_':
+		return true
+	default:
+		// MySQL allows the rest of the Basic Multilingual Plane in unquoted names
+		return r >= 0x80 && r <= 0xFFFF && r != utf8.RuneError
+	}
+}
+
+// validateIdentifier checks a database or table name against the rules of MySQL
+func validateIdentifier(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("the name is empty")
+	case utf8.RuneCountInString(name) > maxIdentifierLength:
+		return fmt.Errorf("the name is longer than %d characters", maxIdentifierLength)
+	case strings.HasSuffix(name, " "):
+		return fmt.Errorf("the name ends with a space")
+	}
+	for _, r := range name {
+		if r == 0 || r > 0xFFFF || r == utf8.RuneError {
+			return fmt.Errorf("the name contains the invalid character %q", r)
+		}
+	}
+	return nil
+}
+
+// String returns the name quoted in backticks, qualified with its database if it has one
+func (n TableName) String() string {
+	if n.Schema == "" {
+		return quoteIdentifier(n.Table)
+	}
+	return quoteIdentifier(n.Schema) + "." + quoteIdentifier(n.Table)
+}
+
+// ResolveTable parses a table name given to a tool and checks through information_schema that the
+// table exists and is not hidden by access rules. An unqualified name refers to database, or to the
+// default database of the connection when database is empty. The name is returned qualified,
+// in the letter case the server stores it in
+func ResolveTable(ctx context.Context, conn *Connection, name, database string) (TableName, error) {
+	table, err := ParseTableName(name)
+	if err != nil {
+		return TableName{}, err
+	}
+	if database != "" {
+		if database, err = ParseIdentifier(database); err != nil {
+			return TableName{}, fmt.Errorf("invalid database: %v", err)
+		}
+		if table.Schema != "" && table.Schema != database {
+			return TableName{}, fmt.Errorf("table %s is qualified with a different database than %s", table, quoteIdentifier(database))
+		}
+	}
+
+	if table.Schema == "" {
+		table.Schema = database
+	}
+	if table.Schema == "" {
+		table.Schema = conn.Database
+	}
+	if table.Schema == "" {
+		return TableName{}, fmt.Errorf("no database selected for table %s, pass database or qualify the name as database.table", table)
+	}
+
+	// Hidden tables are reported as denied whether they exist or not
+	if !conn.Access.TableAllowed(table.Schema, table.Table) {
+		return TableName{}, fmt.Errorf("access denied: table %s is not allowed", table)
+	}
+
+	var found TableName
+	err = conn.ReadDB.QueryRowxContext(ctx,
+		"SELECT TABLE_SCHEMA, TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ?",
+		table.Schema, table.Table).Scan(&found.Schema, &found.Table)
+	if errors.Is(err, sql.ErrNoRows) {
+		return TableName{}, fmt.Errorf("table %s does not exist", table)
+	}
+	if err != nil {
+		return TableName{}, statementError(ctx, err)
+	}
+	return found, nil
+}
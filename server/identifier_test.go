@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTableName(t *testing.T) {
+	valid := []struct {
+		name   string
+		parsed TableName
+		quoted string
+	}{
+		{"users", TableName{Table: "users"}, "`users`"},
+		{" shop.users ", TableName{Schema: "shop", Table: "users"}, "`shop`.`users`"},
+		{"`order`", TableName{Table: "order"}, "`order`"},
+		{"`my.db`.`order items`", TableName{Schema: "my.db", Table: "order items"}, "`my.db`.`order items`"},
+		{"shop.`we``ird`", TableName{Schema: "shop", Table: "we`ird"}, "`shop`.`we``ird`"},
+		{"$tmp_2", TableName{Table: "$tmp_2"}, "`$tmp_2`"},
+		{"テーブル", TableName{Table: "テーブル"}, "`テーブル`"},
+	}
+	for _, tt := range valid {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := ParseTableName(tt.name)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.parsed, parsed)
+			assert.Equal(t, tt.quoted, parsed.String())
+		})
+	}
+
+	invalid := []struct {
+		name string
+		err  string
+	}{
+		{"", "the name is empty"},
+		{"users; DROP TABLE users", `';' is only allowed in names quoted in backticks`},
+		{"users`", "'`' is only allowed in names quoted in backticks"},
+		{"`users", "missing closing backtick"},
+		{"`users`x", "unexpected \"x\" after `users`"},
+		{"a.b.c", "expected table or database.table"},
+		{"shop.", "the name is empty"},
+		{"`trailing `", "the name ends with a space"},
+		{strings.Repeat("a", 65), "longer than 64 characters"},
+	}
+	for _, tt := range invalid {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseTableName(tt.name)
+			assert.ErrorContains(t, err, tt.err)
+		})
+	}
+}
+
+func TestParseIdentifier(t *testing.T) {
+	name, err := ParseIdentifier("`my.db`")
+	assert.NoError(t, err)
+	assert.Equal(t, "my.db", name)
+
+	_, err = ParseIdentifier("shop.users")
+	assert.ErrorContains(t, err, "unexpected \".users\" after `shop`")
+}
+
+func TestResolveTableRejectsBeforeQuerying(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Access.Rules = []config.AccessRule{{Action: AccessDeny, Table: "secret_*"}}
+	access, err := NewAccessPolicy(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// No database handle: every case must fail before a query is sent
+	conn := &Connection{Name: "default", Database: "shop", Access: access}
+
+	_, err = ResolveTable(context.Background(), conn, "users` WHERE 1", "")
+	assert.ErrorContains(t, err, "invalid table name")
+
+	_, err = ResolveTable(context.Background(), conn, "shop.users", "crm")
+	assert.ErrorContains(t, err, "table `shop`.`users` is qualified with a different database than `crm`")
+
+	_, err = ResolveTable(context.Background(), conn, "secret_keys", "")
+	assert.EqualError(t, err, "access denied: table `shop`.`secret_keys` is not allowed")
+
+	_, err = ResolveTable(context.Background(), &Connection{Name: "default"}, "users", "")
+	assert.ErrorContains(t, err, "no database selected for table `users`")
+}
@@ -0,0 +1,364 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+const (
+	MaskRedact  = "redact"
+	MaskPartial = "partial"
+	MaskHash    = "hash"
+	MaskNull    = "null"
+
+	// maskRedacted replaces values of redacted columns
+	maskRedacted = "[REDACTED]"
+	// maskKeepChars is how many trailing characters partial masking leaves visible
+	maskKeepChars = 4
+)
+
+// Masker replaces the values of sensitive columns in query results. A nil masker masks nothing
+type Masker struct {
+	rules []maskRule
+	key   []byte
+}
+
+// maskRule is a configured rule with its patterns prepared for matching
+type maskRule struct {
+	mode   string
+	table  string
+	column string
+	regex  *regexp.Regexp
+}
+
+// NewMasker - Create the masker from the configured rules
+func NewMasker(cfg *config.Config) (*Masker, error) {
+	m := &Masker{key: []byte(cfg.Masking.HashKey)}
+	for i, rule := range cfg.Masking.Rules {
+		r := maskRule{mode: strings.ToLower(rule.Mode)}
+		switch r.mode {
+		case MaskRedact, MaskPartial, MaskHash, MaskNull:
+		default:
+			return nil, fmt.Errorf("masking rule %d has unknown mode %q, expected %s, %s, %s or %s", i, rule.Mode, MaskRedact, MaskPartial, MaskHash, MaskNull)
+		}
+
+		if rule.Column == "" && rule.ColumnRegex == "" {
+			return nil, fmt.Errorf("masking rule %d needs a column or column_regex", i)
+		}
+		if rule.Column != "" {
+			pattern := strings.ToLower(rule.Column)
+			// A pattern without a table matches the column in every table
+			r.table, r.column = "*", pattern
+			if i := strings.LastIndex(pattern, "."); i >= 0 {
+				r.table, r.column = pattern[:i], pattern[i+1:]
+			}
+			for _, p := range []string{r.table, r.column} {
+				if _, err := path.Match(p, ""); err != nil {
+					return nil, fmt.Errorf("masking rule %d has an invalid column pattern %q: %v", i, rule.Column, err)
+				}
+			}
+		}
+		if rule.ColumnRegex != "" {
+			regex, err := regexp.Compile("(?i)" + rule.ColumnRegex)
+			if err != nil {
+				return nil, fmt.Errorf("masking rule %d has an invalid column_regex %q: %v", i, rule.ColumnRegex, err)
+			}
+			r.regex = regex
+		}
+		m.rules = append(m.rules, r)
+	}
+	return m, nil
+}
+
+// Enabled reports whether any rule is configured
+func (m *Masker) Enabled() bool {
+	return m != nil && len(m.rules) > 0
+}
+
+// matches reports whether the rule applies to a column of a table. table is empty when the source is unknown
+func (r maskRule) matches(table, column string) bool {
+	table, column = strings.ToLower(table), strings.ToLower(column)
+	if r.column != "" {
+		if ok, _ := path.Match(r.column, column); !ok {
+			return false
+		}
+		if r.table != "*" {
+			if ok, _ := path.Match(r.table, table); !ok || table == "" {
+				return false
+			}
+		}
+	}
+	return r.regex == nil || r.regex.MatchString(column)
+}
+
+// matchesAnyColumn reports whether the rule may apply to some column of a table. table is empty when the source is unknown
+func (r maskRule) matchesAnyColumn(table string) bool {
+	if r.column == "" || r.table == "*" {
+		return true
+	}
+	ok, _ := path.Match(r.table, strings.ToLower(table))
+	return ok && table != ""
+}
+
+// maskSource is a table column a result column may come from
+type maskSource struct {
+	table  string
+	column string
+	// anyColumn is set for a * whose columns cannot be named, which may be any column of the table
+	anyColumn bool
+}
+
+// Columns returns the masking mode of each result column, empty for columns shown as they are,
+// or nil if no column is masked. A result column is masked when any table column it may come from
+// matches a rule: a column of the same name in a table of the statement, or a column used in
+// the select expression that produces it. In a UNION, EXCEPT or INTERSECT the field at the same
+// position of every SELECT produces the column. The first matching rule wins
+func (m *Masker) Columns(stmt *Statement, columns []ColumnInfo) []string {
+	if !m.Enabled() {
+		return nil
+	}
+
+	sources := map[string][]maskSource{}
+	var all []maskSource
+	tables := []tableRef{}
+	if stmt != nil {
+		sources, all, tables = resultSources(stmt)
+	}
+
+	var modes []string
+	for i, col := range columns {
+		candidates := []maskSource{{column: col.Name}}
+		for _, ref := range tables {
+			candidates = append(candidates, maskSource{table: ref.table, column: col.Name})
+		}
+		candidates = append(candidates, sources[strings.ToLower(col.Name)]...)
+		candidates = append(candidates, all...)
+		if mode := m.match(candidates); mode != "" {
+			if modes == nil {
+				modes = make([]string, len(columns))
+			}
+			modes[i] = mode
+		}
+	}
+	return modes
+}
+
+func (m *Masker) match(candidates []maskSource) string {
+	for _, rule := range m.rules {
+		for _, source := range candidates {
+			if source.anyColumn && rule.matchesAnyColumn(source.table) || !source.anyColumn && rule.matches(source.table, source.column) {
+				return rule.mode
+			}
+		}
+	}
+	return ""
+}
+
+// Mask applies a masking mode to a converted value. NULL stays NULL in every mode
+func (m *Masker) Mask(mode string, v interface{}) interface{} {
+	if v == nil {
+		return nil
+	}
+
+	switch mode {
+	case MaskRedact:
+		return maskRedacted
+	case MaskPartial:
+		runes := []rune(fmt.Sprint(v))
+		keep := maskKeepChars
+		if len(runes) <= keep {
+			keep = 0
+		}
+		return strings.Repeat("*", len(runes)-keep) + string(runes[len(runes)-keep:])
+	case MaskHash:
+		// HMAC with the configured key, so pseudonyms cannot be reversed by hashing guessed values
+		mac := hmac.New(sha256.New, m.key)
+		mac.Write([]byte(fmt.Sprint(v)))
+		return hex.EncodeToString(mac.Sum(nil)[:16])
+	case MaskNull:
+		return nil
+	default:
+		return v
+	}
+}
+
+// applyMasking makes the scanner mask the columns of query's result that match a rule and flags them
+// in the column metadata. A query that cannot be parsed is masked by its column names alone
+func (s *rowScanner) applyMasking(masker *Masker, query string) {
+	if !masker.Enabled() {
+		return
+	}
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		stmt = nil
+	}
+
+	s.masker = masker
+	s.masks = masker.Columns(stmt, s.columns)
+	for i, mode := range s.masks {
+		s.columns[i].Masked = mode
+	}
+}
+
+// resultSources maps each output column name of a statement, lowercased, to the table columns
+// its select fields use. It also returns the sources of every output column, from the SELECTs
+// of a set operation that cannot be lined up with the first one, and the tables of the statement,
+// any of which may provide a column of the same name through *
+func resultSources(stmt *Statement) (map[string][]maskSource, []maskSource, []tableRef) {
+	refs := newTableRefCollector("")
+	stmt.Node.Accept(refs)
+
+	finder := &fieldSourceFinder{refs: refs, sources: map[string][]maskSource{}}
+	stmt.Node.Accept(finder)
+	return finder.sources, finder.all, refs.tables
+}
+
+// fieldSourceFinder collects the table columns used by each select field, keyed by the field's output name
+type fieldSourceFinder struct {
+	refs    *tableRefCollector
+	sources map[string][]maskSource
+	// all are the sources of every output column
+	all []maskSource
+}
+
+func (f *fieldSourceFinder) Enter(n ast.Node) (ast.Node, bool) {
+	switch node := n.(type) {
+	case *ast.SetOprStmt:
+		f.setOperation(node)
+	case *ast.SelectField:
+		if node.Expr != nil {
+			name, sources := f.fieldSources(node)
+			f.sources[name] = append(f.sources[name], sources...)
+		}
+	}
+	return n, false
+}
+
+func (f *fieldSourceFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// setOperation records the fields of the later SELECTs of a UNION, EXCEPT or INTERSECT under the name
+// of the first SELECT's field at the same position, which names the result column. A field after a *
+// has no known position, and a * or TABLE has no known columns, so they are sources of every column
+func (f *fieldSourceFinder) setOperation(stmt *ast.SetOprStmt) {
+	selects := setOperationSelects(stmt.SelectList)
+	if len(selects) == 0 {
+		return
+	}
+
+	names := []string{}
+	if selects[0].Fields != nil {
+		for _, field := range selects[0].Fields.Fields {
+			if field.WildCard != nil {
+				break
+			}
+			name, _ := f.fieldSources(field)
+			names = append(names, name)
+		}
+	}
+
+	for _, sel := range selects[1:] {
+		if sel.Fields == nil {
+			f.all = append(f.all, f.anyColumn()...)
+			continue
+		}
+		aligned := true
+		for i, field := range sel.Fields.Fields {
+			if field.WildCard != nil {
+				if aligned {
+					f.all = append(f.all, f.anyColumn()...)
+				}
+				aligned = false
+				continue
+			}
+			_, sources := f.fieldSources(field)
+			if aligned && i < len(names) {
+				f.sources[names[i]] = append(f.sources[names[i]], sources...)
+			} else {
+				f.all = append(f.all, sources...)
+			}
+		}
+	}
+}
+
+// anyColumn returns the sources of a * whose columns cannot be named: any column of any table of the statement
+func (f *fieldSourceFinder) anyColumn() []maskSource {
+	sources := []maskSource{{anyColumn: true}}
+	for _, ref := range f.refs.tables {
+		sources = append(sources, maskSource{table: ref.table, anyColumn: true})
+	}
+	return sources
+}
+
+// fieldSources returns the output name of a select field and the table columns its expression uses
+func (f *fieldSourceFinder) fieldSources(field *ast.SelectField) (string, []maskSource) {
+	name := field.AsName.L
+	if name == "" {
+		if col, ok := field.Expr.(*ast.ColumnNameExpr); ok {
+			name = col.Name.Name.L
+		} else {
+			// MySQL names an unaliased expression after its text
+			name = strings.ToLower(strings.TrimSpace(field.Text()))
+		}
+	}
+
+	sources := []maskSource{}
+	columns := &columnNameCollector{}
+	field.Expr.Accept(columns)
+	for _, col := range columns.names {
+		tables := f.refs.tables
+		if col.Table.L != "" {
+			tables = f.refs.lookup(col.Schema, col.Table)
+		}
+		// A column from a derived table or CTE has no table, so only column patterns match it
+		sources = append(sources, maskSource{column: col.Name.O})
+		for _, ref := range tables {
+			sources = append(sources, maskSource{table: ref.table, column: col.Name.O})
+		}
+	}
+	return name, sources
+}
+
+// setOperationSelects returns the SELECTs of a set operation in order, including those of nested set operations
+func setOperationSelects(list *ast.SetOprSelectList) []*ast.SelectStmt {
+	if list == nil {
+		return nil
+	}
+	selects := []*ast.SelectStmt{}
+	for _, node := range list.Selects {
+		switch n := node.(type) {
+		case *ast.SelectStmt:
+			selects = append(selects, n)
+		case *ast.SetOprSelectList:
+			selects = append(selects, setOperationSelects(n)...)
+		case *ast.SetOprStmt:
+			selects = append(selects, setOperationSelects(n.SelectList)...)
+		}
+	}
+	return selects
+}
+
+// columnNameCollector collects the column names an expression uses
+type columnNameCollector struct {
+	names []*ast.ColumnName
+}
+
+func (c *columnNameCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if col, ok := n.(*ast.ColumnName); ok {
+		c.names = append(c.names, col)
+	}
+	return n, false
+}
+
+func (c *columnNameCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
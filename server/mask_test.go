@@ -0,0 +1,127 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestMasker(t *testing.T, rules ...config.MaskRule) *Masker {
+	cfg := &config.Config{}
+	cfg.Masking.Rules = rules
+	cfg.Masking.HashKey = "secret"
+	m, err := NewMasker(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return m
+}
+
+func TestNewMasker(t *testing.T) {
+	cfg := &config.Config{}
+
+	t.Run("unknown mode", func(t *testing.T) {
+		cfg.Masking.Rules = []config.MaskRule{{Column: "email", Mode: "scramble"}}
+		_, err := NewMasker(cfg)
+		assert.ErrorContains(t, err, `unknown mode "scramble"`)
+	})
+
+	t.Run("no pattern", func(t *testing.T) {
+		cfg.Masking.Rules = []config.MaskRule{{Mode: MaskNull}}
+		_, err := NewMasker(cfg)
+		assert.ErrorContains(t, err, "needs a column or column_regex")
+	})
+
+	t.Run("invalid regex", func(t *testing.T) {
+		cfg.Masking.Rules = []config.MaskRule{{ColumnRegex: "(", Mode: MaskNull}}
+		_, err := NewMasker(cfg)
+		assert.ErrorContains(t, err, "invalid column_regex")
+	})
+
+	t.Run("nil masker", func(t *testing.T) {
+		var m *Masker
+		assert.False(t, m.Enabled())
+		assert.Nil(t, m.Columns(nil, []ColumnInfo{{Name: "email"}}))
+	})
+}
+
+func TestMaskerMask(t *testing.T) {
+	m := newTestMasker(t)
+
+	assert.Equal(t, "[REDACTED]", m.Mask(MaskRedact, "alice@example.com"))
+	assert.Equal(t, "*******6789", m.Mask(MaskPartial, "090-12-6789"))
+	assert.Equal(t, "****", m.Mask(MaskPartial, "1234"))
+	assert.Equal(t, "******6789", m.Mask(MaskPartial, int64(1234566789)))
+	assert.Nil(t, m.Mask(MaskNull, "alice"))
+	assert.Nil(t, m.Mask(MaskRedact, nil))
+
+	hashed := m.Mask(MaskHash, "alice@example.com")
+	assert.Len(t, hashed, 32)
+	assert.Equal(t, hashed, m.Mask(MaskHash, "alice@example.com"))
+	assert.NotEqual(t, hashed, m.Mask(MaskHash, "bob@example.com"))
+
+	other := &Masker{key: []byte("other")}
+	assert.NotEqual(t, hashed, other.Mask(MaskHash, "alice@example.com"))
+}
+
+func TestMaskerColumns(t *testing.T) {
+	m := newTestMasker(t,
+		config.MaskRule{Column: "users.email", Mode: MaskHash},
+		config.MaskRule{Column: "*.phone", Mode: MaskPartial},
+		config.MaskRule{ColumnRegex: "^(ssn|national_id)$", Mode: MaskRedact},
+	)
+	columns := func(query string, names ...string) []string {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		cols := make([]ColumnInfo, len(names))
+		for i, name := range names {
+			cols[i] = ColumnInfo{Name: name}
+		}
+		return m.Columns(stmt, cols)
+	}
+
+	assert.Equal(t, []string{"", MaskHash}, columns("SELECT id, email FROM users", "id", "email"))
+	assert.Equal(t, []string{"", MaskHash, MaskPartial}, columns("SELECT * FROM users", "id", "email", "phone"))
+	assert.Equal(t, []string{MaskHash}, columns("SELECT u.email AS contact FROM users u", "contact"))
+	assert.Equal(t, []string{MaskHash}, columns("SELECT LOWER(email) FROM users", "LOWER(email)"))
+	assert.Equal(t, []string{MaskHash}, columns("SELECT x FROM (SELECT email AS x FROM users) d", "x"))
+	assert.Equal(t, []string{MaskRedact}, columns("SELECT SSN FROM people", "SSN"))
+	assert.Equal(t, []string{"", MaskHash}, columns("SELECT (WITH users AS (SELECT 1) SELECT 1) x, u.email FROM users u", "x", "email"))
+	assert.Nil(t, columns("WITH users AS (SELECT 'x' AS email) SELECT email FROM users", "email"))
+	assert.Nil(t, columns("SELECT email FROM orders", "email"))
+	assert.Nil(t, columns("SELECT id FROM users", "id"))
+
+	t.Run("set operations", func(t *testing.T) {
+		// The result columns take the names of the first SELECT, the values come from every SELECT
+		assert.Equal(t, []string{MaskHash}, columns("SELECT id FROM t UNION SELECT email FROM users", "id"))
+		assert.Equal(t, []string{"", MaskHash}, columns("SELECT id, name FROM t UNION ALL SELECT id, name FROM people UNION ALL SELECT id, email FROM users", "id", "name"))
+		assert.Equal(t, []string{MaskHash}, columns("SELECT x FROM (SELECT name AS x FROM t UNION SELECT email FROM users) d", "x"))
+		assert.Equal(t, []string{MaskHash}, columns("(SELECT id FROM t) EXCEPT (SELECT email FROM users)", "id"))
+		assert.Nil(t, columns("SELECT id FROM t UNION SELECT id FROM users", "id"))
+
+		// A * in a later SELECT may place any column anywhere
+		assert.Equal(t, []string{MaskHash, MaskHash}, columns("SELECT id, name FROM t UNION SELECT * FROM users", "id", "name"))
+		assert.Equal(t, []string{MaskHash}, columns("SELECT id FROM t UNION TABLE users", "id"))
+	})
+}
+
+func TestRowScannerMasking(t *testing.T) {
+	m := newTestMasker(t, config.MaskRule{Column: "users.phone", Mode: MaskPartial})
+	scanner := &rowScanner{
+		columns: []ColumnInfo{{Name: "id", Type: "INT"}, {Name: "phone", Type: "VARCHAR"}},
+		conv:    &ValueConverter{},
+	}
+	scanner.applyMasking(m, "SELECT id, phone FROM users")
+	assert.Equal(t, "partial", scanner.columns[1].Masked)
+
+	row, err := scanner.convert([]interface{}{[]byte("1"), []byte("555-0100")})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"id": int64(1), "phone": "****0100"}, row)
+
+	text, err := RenderResult(&QueryResult{Columns: scanner.columns, Rows: []map[string]interface{}{row}}, QueryOptions{Format: FormatCSV})
+	assert.NoError(t, err)
+	assert.Equal(t, "id,phone\n1,****0100\n[masked: phone (partial)]\n", text)
+}
@@ -0,0 +1,150 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// BindParams binds the params argument of a tool call to a query. A JSON array binds
+// positional ? markers, a JSON object binds :name markers outside of quoted strings, quoted
+// identifiers and comments. It returns the query with ? markers and the arguments to pass to the driver
+func BindParams(query string, params interface{}) (string, []interface{}, error) {
+	// Some clients send the params as JSON text rather than as a JSON value
+	if s, ok := params.(string); ok {
+		trimmed := strings.TrimSpace(s)
+		if trimmed == "" {
+			return query, nil, nil
+		}
+		if err := json.Unmarshal([]byte(trimmed), &params); err != nil {
+			return "", nil, fmt.Errorf("params must be a JSON array or object: %v", err)
+		}
+	}
+
+	switch p := params.(type) {
+	case nil:
+		return query, nil, nil
+	case []interface{}:
+		args := make([]interface{}, len(p))
+		for i, v := range p {
+			arg, err := bindValue(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("params[%d]: %v", i, err)
+			}
+			args[i] = arg
+		}
+		return query, args, nil
+	case map[string]interface{}:
+		values := make(map[string]interface{}, len(p))
+		for name, v := range p {
+			arg, err := bindValue(v)
+			if err != nil {
+				return "", nil, fmt.Errorf("params.%s: %v", name, err)
+			}
+			values[name] = arg
+		}
+		bound, args, err := bindNamed(query, values)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to bind named params: %v", err)
+		}
+		return bound, args, nil
+	default:
+		return "", nil, fmt.Errorf("params must be a JSON array or object, got %T", params)
+	}
+}
+
+// bindValue converts a decoded JSON value to a driver argument
+func bindValue(v interface{}) (interface{}, error) {
+	switch x := v.(type) {
+	case float64:
+		// JSON numbers decode as float64; whole numbers are bound as integers so BIGINT keys compare exactly
+		if x == math.Trunc(x) && math.Abs(x) <= 1<<53 {
+			return int64(x), nil
+		}
+		return x, nil
+	case []interface{}, map[string]interface{}:
+		b, err := json.Marshal(x)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	default:
+		// string, bool and nil are supported by the driver as they are
+		return x, nil
+	}
+}
+
+// bindNamed replaces the :name markers of a query with ? and returns the values in marker order.
+// Colons inside quoted strings, backtick identifiers and comments are left alone, so that
+// literals such as '10:30' are not taken for markers
+func bindNamed(query string, values map[string]interface{}) (string, []interface{}, error) {
+	var b strings.Builder
+	args := []interface{}{}
+	for i := 0; i < len(query); {
+		if n := skipNonCode(query, i); n > i {
+			b.WriteString(query[i:n])
+			i = n
+			continue
+		}
+		if query[i] != ':' || i+1 >= len(query) || !isParamNameChar(query[i+1]) {
+			b.WriteByte(query[i])
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(query) && isParamNameChar(query[end]) {
+			end++
+		}
+		name := query[i+1 : end]
+		v, ok := values[name]
+		if !ok {
+			return "", nil, fmt.Errorf("no value for :%s", name)
+		}
+		b.WriteByte('?')
+		args = append(args, v)
+		i = end
+	}
+	return b.String(), args, nil
+}
+
+// skipNonCode returns the end of the quoted string, quoted identifier or comment starting at i,
+// or i when the query has none there. An unterminated one runs to the end of the query
+func skipNonCode(query string, i int) int {
+	switch c := query[i]; {
+	case c == '\'' || c == '"' || c == '`':
+		for j := i + 1; j < len(query); j++ {
+			switch query[j] {
+			case '\\':
+				// Backslash escapes apply in strings, not in identifiers
+				if c != '`' {
+					j++
+				}
+			case c:
+				// A doubled quote continues the string and is skipped as a new one
+				return j + 1
+			}
+		}
+		return len(query)
+	case c == '#' || (c == '-' && strings.HasPrefix(query[i:], "--") && (i+2 == len(query) || isSpace(query[i+2]))):
+		if j := strings.IndexByte(query[i:], '\n'); j >= 0 {
+			return i + j + 1
+		}
+		return len(query)
+	case c == '/' && strings.HasPrefix(query[i:], "/*"):
+		if j := strings.Index(query[i+2:], "*/"); j >= 0 {
+			return i + 2 + j + 2
+		}
+		return len(query)
+	}
+	return i
+}
+
+func isParamNameChar(c byte) bool {
+	return c == '_' || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBindParams(t *testing.T) {
+	t.Run("no params", func(t *testing.T) {
+		query, args, err := BindParams("SELECT 1", nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT 1", query)
+		assert.Nil(t, args)
+	})
+
+	t.Run("positional", func(t *testing.T) {
+		query, args, err := BindParams("SELECT * FROM users WHERE id = ? AND name = ? AND active = ? AND deleted_at IS ?",
+			[]interface{}{float64(42), "o'brien", true, nil})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM users WHERE id = ? AND name = ? AND active = ? AND deleted_at IS ?", query)
+		assert.Equal(t, []interface{}{int64(42), "o'brien", true, nil}, args)
+	})
+
+	t.Run("named", func(t *testing.T) {
+		query, args, err := BindParams("SELECT * FROM users WHERE name = :name AND age > :age AND name <> :name",
+			map[string]interface{}{"name": "alice", "age": float64(30)})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM users WHERE name = ? AND age > ? AND name <> ?", query)
+		assert.Equal(t, []interface{}{"alice", int64(30), "alice"}, args)
+	})
+
+	t.Run("colons in literals and comments are not params", func(t *testing.T) {
+		query, args, err := BindParams("SELECT * FROM logs WHERE t = '10:30' AND `a:b` = \"it\\\":s\" /* :x */ AND id = :id -- :y\n# :z\nAND n = :n",
+			map[string]interface{}{"id": float64(7), "n": "a"})
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT * FROM logs WHERE t = '10:30' AND `a:b` = \"it\\\":s\" /* :x */ AND id = ? -- :y\n# :z\nAND n = ?", query)
+		assert.Equal(t, []interface{}{int64(7), "a"}, args)
+	})
+
+	t.Run("missing named param", func(t *testing.T) {
+		_, _, err := BindParams("SELECT * FROM users WHERE name = :name", map[string]interface{}{})
+		assert.Error(t, err)
+	})
+
+	t.Run("params as JSON text", func(t *testing.T) {
+		_, args, err := BindParams("SELECT ?", `[1.5]`)
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{1.5}, args)
+	})
+
+	t.Run("nested values are bound as JSON", func(t *testing.T) {
+		_, args, err := BindParams("INSERT INTO t (doc) VALUES (?)", []interface{}{map[string]interface{}{"a": []interface{}{float64(1)}}})
+		assert.NoError(t, err)
+		assert.Equal(t, []interface{}{`{"a":[1]}`}, args)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		_, _, err := BindParams("SELECT ?", float64(1))
+		assert.Error(t, err)
+		_, _, err = BindParams("SELECT ?", "not json")
+		assert.Error(t, err)
+	})
+
+	t.Run("bound queries still parse", func(t *testing.T) {
+		query, _, err := BindParams("DELETE FROM users WHERE id = :id", map[string]interface{}{"id": float64(1)})
+		assert.NoError(t, err)
+		stmt, err := CheckStatement(query, StatementTypeDelete)
+		assert.NoError(t, err)
+		assert.Equal(t, StatementTypeDelete, stmt.Kind)
+	})
+}
@@ -0,0 +1,245 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+const (
+	PlanActionReject = "reject"
+	PlanActionWarn   = "warn"
+)
+
+// PlanGuard judges the EXPLAIN FORMAT=JSON plan of a statement against the limits of the explain section
+type PlanGuard struct {
+	// warn runs statements over a limit and reports the problems instead of rejecting them
+	warn            bool
+	fullScanRows    float64
+	maxRowsExamined float64
+	sortRows        float64
+	maxCost         float64
+}
+
+// NewPlanGuard - Create the plan guard from the explain configuration, or nil when no limit is set
+func NewPlanGuard(cfg *config.Config) (*PlanGuard, error) {
+	c := cfg.Explain
+	switch c.Action {
+	case PlanActionReject, PlanActionWarn, "":
+	default:
+		return nil, fmt.Errorf("unknown explain action %q, expected %q or %q", c.Action, PlanActionReject, PlanActionWarn)
+	}
+	if c.FullScanRows < 0 || c.MaxRowsExamined < 0 || c.SortRows < 0 || c.MaxCost < 0 {
+		return nil, fmt.Errorf("explain limits must not be negative")
+	}
+	if c.FullScanRows == 0 && c.MaxRowsExamined == 0 && c.SortRows == 0 && c.MaxCost == 0 {
+		return nil, nil
+	}
+
+	return &PlanGuard{
+		warn:            c.Action == PlanActionWarn,
+		fullScanRows:    float64(c.FullScanRows),
+		maxRowsExamined: float64(c.MaxRowsExamined),
+		sortRows:        float64(c.SortRows),
+		maxCost:         c.MaxCost,
+	}, nil
+}
+
+// Check explains the statement and judges its plan. Problems are returned as warnings
+// in warn mode and as an error naming every part of the plan over a limit otherwise
+func (g *PlanGuard) Check(ctx context.Context, db sqlx.QueryerContext, query string, args []interface{}) ([]string, error) {
+	var plan string
+	if err := db.QueryRowxContext(ctx, "EXPLAIN FORMAT=JSON "+query, args...).Scan(&plan); err != nil {
+		return nil, fmt.Errorf("unable to check query plan: %v", err)
+	}
+
+	problems, err := g.Problems([]byte(plan))
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) == 0 {
+		return nil, nil
+	}
+	if g.warn {
+		zap.S().Warnw("query plan over explain limits", "query", query, "problems", problems)
+		warnings := make([]string, len(problems))
+		for i, problem := range problems {
+			warnings[i] = "query plan: " + problem
+		}
+		return warnings, nil
+	}
+	return nil, fmt.Errorf("query plan rejected: %s", strings.Join(problems, "; "))
+}
+
+// Problems lists the parts of an EXPLAIN FORMAT=JSON plan that are over a limit.
+// Both the MySQL and the MariaDB layout of the plan are understood
+func (g *PlanGuard) Problems(plan []byte) ([]string, error) {
+	var root map[string]any
+	decoder := json.NewDecoder(bytes.NewReader(plan))
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, fmt.Errorf("unable to check query plan: %v", err)
+	}
+
+	w := &planWalker{guard: g}
+	estimate := w.walk(root)
+
+	if g.maxRowsExamined > 0 && estimate.examined > g.maxRowsExamined {
+		w.problems = append(w.problems, fmt.Sprintf("the query examines an estimated %.0f rows (explain.max_rows_examined: %.0f)",
+			estimate.examined, g.maxRowsExamined))
+	}
+	if block, ok := root["query_block"].(map[string]any); ok && g.maxCost > 0 {
+		if costInfo, ok := block["cost_info"].(map[string]any); ok {
+			if cost, ok := planNumber(costInfo["query_cost"]); ok && cost > g.maxCost {
+				w.problems = append(w.problems, fmt.Sprintf("the estimated query cost is %g (explain.max_cost: %g)", cost, g.maxCost))
+			}
+		}
+	}
+	return w.problems, nil
+}
+
+// planEstimate is what the walk of a plan node found out about the rows it handles
+type planEstimate struct {
+	// examined is the number of rows the node reads in total
+	examined float64
+	// produced is the number of rows the node passes on
+	produced float64
+	// cumulative is set when produced already counts the rows of the preceding tables of a join,
+	// as rows_produced_per_join of MySQL does
+	cumulative bool
+}
+
+// planWalker collects the problems of the plan nodes it visits
+type planWalker struct {
+	guard    *PlanGuard
+	problems []string
+}
+
+// walk estimates the rows of a plan node and its children
+func (w *planWalker) walk(node any) planEstimate {
+	switch n := node.(type) {
+	case []any:
+		total := planEstimate{}
+		for _, child := range n {
+			e := w.walk(child)
+			total.examined += e.examined
+			total.produced = max(total.produced, e.produced)
+			total.cumulative = total.cumulative || e.cumulative
+		}
+		return total
+	case map[string]any:
+		if _, ok := n["table_name"]; ok {
+			return w.table(n)
+		}
+		e := w.children(n, map[string]bool{"nested_loop": true})
+		if loop, ok := n["nested_loop"].([]any); ok {
+			join := w.nestedLoop(loop)
+			e.examined += join.examined
+			e.produced = max(e.produced, join.produced)
+		}
+		w.checkSort(n, e.produced)
+		return e
+	default:
+		return planEstimate{}
+	}
+}
+
+// children walks the values of a node in key order, skipping the given keys
+func (w *planWalker) children(n map[string]any, skip map[string]bool) planEstimate {
+	keys := make([]string, 0, len(n))
+	for key := range n {
+		if !skip[key] {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	total := planEstimate{}
+	for _, key := range keys {
+		e := w.walk(n[key])
+		total.examined += e.examined
+		total.produced = max(total.produced, e.produced)
+		total.cumulative = total.cumulative || e.cumulative
+	}
+	return total
+}
+
+// table estimates the rows of a table access and flags a full scan of a large table
+func (w *planWalker) table(n map[string]any) planEstimate {
+	perScan, ok := planNumber(n["rows_examined_per_scan"])
+	if !ok {
+		perScan, _ = planNumber(n["rows"])
+	}
+
+	e := planEstimate{examined: perScan, produced: perScan}
+	if produced, ok := planNumber(n["rows_produced_per_join"]); ok {
+		e.produced, e.cumulative = produced, true
+	} else if filtered, ok := planNumber(n["filtered"]); ok {
+		e.produced = perScan * filtered / 100
+	}
+
+	if n["access_type"] == "ALL" && w.guard.fullScanRows > 0 && perScan > w.guard.fullScanRows {
+		w.problems = append(w.problems, fmt.Sprintf("full table scan of %s over an estimated %.0f rows (explain.full_scan_rows: %.0f)",
+			quoteIdentifier(fmt.Sprint(n["table_name"])), perScan, w.guard.fullScanRows))
+	}
+
+	// Subqueries attached to the table are run for the table's rows, MariaDB also nests sorts here
+	sub := w.children(n, map[string]bool{"table_name": true})
+	e.examined += sub.examined
+	w.checkSort(n, e.produced)
+	return e
+}
+
+// nestedLoop estimates a join: each table is read once for every row of the tables before it
+func (w *planWalker) nestedLoop(loop []any) planEstimate {
+	total := planEstimate{}
+	prefix := 1.0
+	for _, child := range loop {
+		e := w.walk(child)
+		total.examined += e.examined * prefix
+		if e.cumulative {
+			prefix = e.produced
+		} else {
+			prefix *= e.produced
+		}
+	}
+	total.produced = prefix
+	return total
+}
+
+// checkSort flags a filesort or a temporary table over more rows than explain.sort_rows
+func (w *planWalker) checkSort(n map[string]any, rows float64) {
+	if w.guard.sortRows == 0 || rows <= w.guard.sortRows {
+		return
+	}
+	_, mariaDBSort := n["filesort"]
+	if n["using_filesort"] == true || mariaDBSort {
+		w.problems = append(w.problems, fmt.Sprintf("filesort of an estimated %.0f rows (explain.sort_rows: %.0f)", rows, w.guard.sortRows))
+	}
+	_, mariaDBTemporary := n["temporary_table"]
+	if n["using_temporary_table"] == true || mariaDBTemporary {
+		w.problems = append(w.problems, fmt.Sprintf("temporary table of an estimated %.0f rows (explain.sort_rows: %.0f)", rows, w.guard.sortRows))
+	}
+}
+
+// planNumber reads a number of the plan, which MySQL writes either as a JSON number or as a string
+func planNumber(v any) (float64, bool) {
+	switch n := v.(type) {
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
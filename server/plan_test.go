@@ -0,0 +1,135 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+// orderedJoinPlan is the MySQL plan of a join of two tables sorted through a temporary table
+const orderedJoinPlan = `{
+  "query_block": {
+    "select_id": 1,
+    "cost_info": {"query_cost": "25412.80"},
+    "ordering_operation": {
+      "using_temporary_table": true,
+      "using_filesort": true,
+      "nested_loop": [
+        {
+          "table": {
+            "table_name": "o",
+            "access_type": "ALL",
+            "rows_examined_per_scan": 20000,
+            "rows_produced_per_join": 2000,
+            "filtered": "10.00",
+            "cost_info": {"read_cost": "1800.00", "eval_cost": "200.00", "prefix_cost": "2000.00"}
+          }
+        },
+        {
+          "table": {
+            "table_name": "c",
+            "access_type": "eq_ref",
+            "key": "PRIMARY",
+            "rows_examined_per_scan": 1,
+            "rows_produced_per_join": 2000,
+            "filtered": "100.00"
+          }
+        }
+      ]
+    }
+  }
+}`
+
+func newTestPlanGuard(t *testing.T, configure func(cfg *config.Config)) *PlanGuard {
+	cfg := &config.Config{}
+	cfg.Explain.Action = PlanActionReject
+	configure(cfg)
+	g, err := NewPlanGuard(cfg)
+	if !assert.NoError(t, err) || !assert.NotNil(t, g) {
+		t.FailNow()
+	}
+	return g
+}
+
+func TestNewPlanGuard(t *testing.T) {
+	cfg := &config.Config{}
+
+	t.Run("disabled", func(t *testing.T) {
+		g, err := NewPlanGuard(cfg)
+		assert.NoError(t, err)
+		assert.Nil(t, g)
+	})
+
+	t.Run("unknown action", func(t *testing.T) {
+		cfg.Explain.Action = "block"
+		_, err := NewPlanGuard(cfg)
+		assert.ErrorContains(t, err, `unknown explain action "block"`)
+	})
+
+	t.Run("negative limit", func(t *testing.T) {
+		cfg.Explain.Action = PlanActionWarn
+		cfg.Explain.MaxCost = -1
+		_, err := NewPlanGuard(cfg)
+		assert.ErrorContains(t, err, "must not be negative")
+	})
+}
+
+func TestPlanGuardProblems(t *testing.T) {
+	problems := func(g *PlanGuard, plan string) []string {
+		p, err := g.Problems([]byte(plan))
+		assert.NoError(t, err)
+		return p
+	}
+
+	t.Run("full table scan", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.FullScanRows = 10000 })
+		assert.Equal(t, []string{"full table scan of `o` over an estimated 20000 rows (explain.full_scan_rows: 10000)"}, problems(g, orderedJoinPlan))
+
+		g = newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.FullScanRows = 50000 })
+		assert.Empty(t, problems(g, orderedJoinPlan))
+	})
+
+	t.Run("rows examined", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.MaxRowsExamined = 21000 })
+		assert.Equal(t, []string{"the query examines an estimated 22000 rows (explain.max_rows_examined: 21000)"}, problems(g, orderedJoinPlan))
+	})
+
+	t.Run("filesort and temporary table", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.SortRows = 1000 })
+		assert.Equal(t, []string{
+			"filesort of an estimated 2000 rows (explain.sort_rows: 1000)",
+			"temporary table of an estimated 2000 rows (explain.sort_rows: 1000)",
+		}, problems(g, orderedJoinPlan))
+	})
+
+	t.Run("query cost", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.MaxCost = 10000 })
+		assert.Equal(t, []string{"the estimated query cost is 25412.8 (explain.max_cost: 10000)"}, problems(g, orderedJoinPlan))
+	})
+
+	t.Run("mariadb", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) {
+			cfg.Explain.FullScanRows = 1000
+			cfg.Explain.SortRows = 1000
+		})
+		plan := `{"query_block": {"select_id": 1, "filesort": {"sort_key": "t.created_at",
+			"table": {"table_name": "t", "access_type": "ALL", "rows": 5000, "filtered": 100}}}}`
+		assert.Equal(t, []string{
+			"full table scan of `t` over an estimated 5000 rows (explain.full_scan_rows: 1000)",
+			"filesort of an estimated 5000 rows (explain.sort_rows: 1000)",
+		}, problems(g, plan))
+	})
+
+	t.Run("invalid plan", func(t *testing.T) {
+		g := newTestPlanGuard(t, func(cfg *config.Config) { cfg.Explain.MaxCost = 1 })
+		_, err := g.Problems([]byte("not json"))
+		assert.ErrorContains(t, err, "unable to check query plan")
+	})
+}
+
+func TestWithWarnings(t *testing.T) {
+	assert.Equal(t, "1 rows affected", withWarnings("1 rows affected", nil))
+	assert.Equal(t, "1 rows affected\n[warning: query plan: slow]\n", withWarnings("1 rows affected", []string{"query plan: slow"}))
+	assert.Equal(t, "id\n1\n[warning: a]\n[warning: b]\n", withWarnings("id\n1\n", []string{"a", "b"}))
+}
@@ -0,0 +1,252 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+const (
+	// inFlightRetryAfter is the retry hint of a call refused by a max_in_flight limit,
+	// as the running calls give no hint of when they finish
+	inFlightRetryAfter = time.Second
+	// rateLimitPruneSize is how many client limiters are kept before idle ones are dropped
+	rateLimitPruneSize = 1024
+)
+
+// RateLimitError reports a tool call refused by a rate limit
+type RateLimitError struct {
+	// Scope describes the limit, such as "the tool read_query" or "client alice"
+	Scope string
+	// Reason describes the limit that was hit
+	Reason     string
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %d s: %s %s", retryAfterSeconds(e.RetryAfter), e.Scope, e.Reason)
+}
+
+// retryAfterSeconds rounds a wait up to whole seconds, and to at least one
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// limiter is the token bucket and the in-flight counter of one scope
+type limiter struct {
+	scope string
+	rule  config.RateLimitRule
+	// rate is the number of tokens added per second, burst the most the bucket holds
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+
+	inFlight int
+}
+
+func newLimiter(scope string, rule config.RateLimitRule, now time.Time) *limiter {
+	l := &limiter{scope: scope, rule: rule, rate: rule.RequestsPerMinute / 60, last: now}
+	l.burst = float64(rule.Burst)
+	if l.burst == 0 {
+		l.burst = math.Max(1, math.Floor(rule.RequestsPerMinute/10))
+	}
+	l.tokens = l.burst
+	return l
+}
+
+// limitEnabled reports whether the rule sets any limit
+func limitEnabled(rule config.RateLimitRule) bool {
+	return rule.RequestsPerMinute > 0 || rule.MaxInFlight > 0
+}
+
+// refill adds the tokens earned since the last refill
+func (l *limiter) refill(now time.Time) {
+	if l.rate == 0 {
+		return
+	}
+	l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+	l.last = now
+}
+
+// check returns an error when the limiter would refuse a call at now
+func (l *limiter) check(now time.Time) *RateLimitError {
+	if l.rule.MaxInFlight > 0 && l.inFlight >= l.rule.MaxInFlight {
+		return &RateLimitError{
+			Scope:      l.scope,
+			Reason:     fmt.Sprintf("allows %d calls at the same time", l.rule.MaxInFlight),
+			RetryAfter: inFlightRetryAfter,
+		}
+	}
+	if l.rate > 0 {
+		l.refill(now)
+		if l.tokens < 1 {
+			return &RateLimitError{
+				Scope:      l.scope,
+				Reason:     fmt.Sprintf("allows %g calls per minute", l.rule.RequestsPerMinute),
+				RetryAfter: time.Duration((1 - l.tokens) / l.rate * float64(time.Second)),
+			}
+		}
+	}
+	return nil
+}
+
+// idle reports whether the limiter holds no state worth keeping: no running call and a full bucket
+func (l *limiter) idle(now time.Time) bool {
+	l.refill(now)
+	return l.inFlight == 0 && (l.rate == 0 || l.tokens >= l.burst)
+}
+
+// RateLimiter refuses tool calls beyond the configured rates and concurrency,
+// globally, per tool and per client
+type RateLimiter struct {
+	client config.RateLimitRule
+
+	mu      sync.Mutex
+	global  *limiter
+	tools   map[string]*limiter
+	clients map[string]*limiter
+	// now is replaced in tests
+	now func() time.Time
+}
+
+// NewRateLimiter - Create the rate limiter from the rate_limit configuration, or nil when no limit is set
+func NewRateLimiter(cfg *config.Config) (*RateLimiter, error) {
+	rules := map[string]config.RateLimitRule{"global": cfg.RateLimit.Global, "client": cfg.RateLimit.Client}
+	for tool, rule := range cfg.RateLimit.Tools {
+		rules["tools."+tool] = rule
+	}
+	configured := false
+	for name, rule := range rules {
+		if rule.RequestsPerMinute < 0 || rule.Burst < 0 || rule.MaxInFlight < 0 {
+			return nil, fmt.Errorf("rate limit %s: limits must not be negative", name)
+		}
+		configured = configured || limitEnabled(rule)
+	}
+	if !configured {
+		return nil, nil
+	}
+
+	now := time.Now()
+	r := &RateLimiter{
+		client:  cfg.RateLimit.Client,
+		tools:   map[string]*limiter{},
+		clients: map[string]*limiter{},
+		now:     time.Now,
+	}
+	if limitEnabled(cfg.RateLimit.Global) {
+		r.global = newLimiter("the server", cfg.RateLimit.Global, now)
+	}
+	for tool, rule := range cfg.RateLimit.Tools {
+		if limitEnabled(rule) {
+			r.tools[tool] = newLimiter("the tool "+tool, rule, now)
+		}
+	}
+	return r, nil
+}
+
+// clientKey identifies the caller: the authenticated principal, or the MCP session without authentication
+func clientKey(ctx context.Context) (string, string) {
+	if principal := PrincipalFromContext(ctx); principal != nil {
+		return "principal:" + principal.Name, "client " + principal.Name
+	}
+	id := sessionID(ctx)
+	return "session:" + id, "session " + id
+}
+
+// acquire admits a call of the tool, or returns the limit that refuses it.
+// The returned function must be called when the call finishes
+func (r *RateLimiter) acquire(ctx context.Context, tool string) (func(), error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := r.now()
+
+	limiters := []*limiter{}
+	if r.global != nil {
+		limiters = append(limiters, r.global)
+	}
+	if l, ok := r.tools[tool]; ok {
+		limiters = append(limiters, l)
+	}
+	if limitEnabled(r.client) {
+		key, scope := clientKey(ctx)
+		l, ok := r.clients[key]
+		if !ok {
+			if len(r.clients) >= rateLimitPruneSize {
+				r.prune(now)
+			}
+			l = newLimiter(scope, r.client, now)
+			r.clients[key] = l
+		}
+		limiters = append(limiters, l)
+	}
+
+	// Every limit is checked before any is charged, and the longest wait is reported,
+	// so retrying after it is not refused by another limit right away
+	var refused *RateLimitError
+	for _, l := range limiters {
+		if err := l.check(now); err != nil && (refused == nil || err.RetryAfter > refused.RetryAfter) {
+			refused = err
+		}
+	}
+	if refused != nil {
+		return nil, refused
+	}
+
+	for _, l := range limiters {
+		if l.rate > 0 {
+			l.tokens--
+		}
+		l.inFlight++
+	}
+	return func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for _, l := range limiters {
+			l.inFlight--
+		}
+	}, nil
+}
+
+// prune drops the limiters of clients that are idle, as a new limiter starts in the same state
+func (r *RateLimiter) prune(now time.Time) {
+	for key, l := range r.clients {
+		if l.idle(now) {
+			delete(r.clients, key)
+		}
+	}
+}
+
+// ForgetSession drops the limiter of an MCP session that ended
+func (r *RateLimiter) ForgetSession(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if l, ok := r.clients["session:"+id]; ok && l.inFlight == 0 {
+		delete(r.clients, "session:"+id)
+	}
+}
+
+// ToolMiddleware refuses tool calls beyond the configured limits with a tool error
+func (r *RateLimiter) ToolMiddleware() server.ToolHandlerMiddleware {
+	return func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+		return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			release, err := r.acquire(ctx, request.Params.Name)
+			if err != nil {
+				zap.S().Warnw("rate limited tool call", "tool", request.Params.Name, "session", sessionID(ctx), "error", err)
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			defer release()
+			return next(ctx, request)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRateLimiter(t *testing.T) {
+	cfg := &config.Config{}
+
+	t.Run("disabled", func(t *testing.T) {
+		r, err := NewRateLimiter(cfg)
+		assert.NoError(t, err)
+		assert.Nil(t, r)
+		r.ForgetSession("session-1")
+	})
+
+	t.Run("negative limit", func(t *testing.T) {
+		cfg.RateLimit.Tools = map[string]config.RateLimitRule{"read_query": {RequestsPerMinute: -1}}
+		_, err := NewRateLimiter(cfg)
+		assert.ErrorContains(t, err, "rate limit tools.read_query: limits must not be negative")
+	})
+}
+
+func TestRateLimiterAcquire(t *testing.T) {
+	setup := func(t *testing.T, configure func(cfg *config.Config)) (*RateLimiter, *time.Time) {
+		cfg := &config.Config{}
+		configure(cfg)
+		r, err := NewRateLimiter(cfg)
+		if !assert.NoError(t, err) || !assert.NotNil(t, r) {
+			t.FailNow()
+		}
+		now := time.Now()
+		r.now = func() time.Time { return now }
+		return r, &now
+	}
+	alice := WithPrincipal(context.Background(), &Principal{Name: "alice", Role: "reader"})
+	bob := WithPrincipal(context.Background(), &Principal{Name: "bob", Role: "reader"})
+
+	t.Run("token bucket", func(t *testing.T) {
+		r, now := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Global = config.RateLimitRule{RequestsPerMinute: 60, Burst: 2}
+		})
+		for i := 0; i < 2; i++ {
+			release, err := r.acquire(alice, "read_query")
+			assert.NoError(t, err)
+			release()
+		}
+		_, err := r.acquire(bob, "read_query")
+		assert.EqualError(t, err, "rate limited, retry after 1 s: the server allows 60 calls per minute")
+
+		*now = now.Add(time.Second)
+		_, err = r.acquire(bob, "read_query")
+		assert.NoError(t, err)
+	})
+
+	t.Run("default burst", func(t *testing.T) {
+		r, _ := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Global = config.RateLimitRule{RequestsPerMinute: 6}
+		})
+		_, err := r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+		_, err = r.acquire(alice, "read_query")
+		assert.EqualError(t, err, "rate limited, retry after 10 s: the server allows 6 calls per minute")
+	})
+
+	t.Run("per tool", func(t *testing.T) {
+		r, _ := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Tools = map[string]config.RateLimitRule{"read_query": {RequestsPerMinute: 1}}
+		})
+		_, err := r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+		_, err = r.acquire(bob, "read_query")
+		assert.EqualError(t, err, "rate limited, retry after 60 s: the tool read_query allows 1 calls per minute")
+		_, err = r.acquire(alice, "list_table")
+		assert.NoError(t, err)
+	})
+
+	t.Run("per client", func(t *testing.T) {
+		r, _ := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Client = config.RateLimitRule{RequestsPerMinute: 1}
+		})
+		_, err := r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+		_, err = r.acquire(alice, "list_table")
+		assert.EqualError(t, err, "rate limited, retry after 60 s: client alice allows 1 calls per minute")
+		_, err = r.acquire(bob, "read_query")
+		assert.NoError(t, err)
+	})
+
+	t.Run("max in flight", func(t *testing.T) {
+		r, _ := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Client = config.RateLimitRule{MaxInFlight: 1}
+		})
+		release, err := r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+		_, err = r.acquire(alice, "read_query")
+		assert.EqualError(t, err, "rate limited, retry after 1 s: client alice allows 1 calls at the same time")
+		_, err = r.acquire(bob, "read_query")
+		assert.NoError(t, err)
+
+		release()
+		_, err = r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+	})
+
+	t.Run("refused calls are not charged", func(t *testing.T) {
+		r, _ := setup(t, func(cfg *config.Config) {
+			cfg.RateLimit.Global = config.RateLimitRule{MaxInFlight: 1}
+			cfg.RateLimit.Client = config.RateLimitRule{RequestsPerMinute: 2, Burst: 2}
+		})
+		release, err := r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+		_, err = r.acquire(alice, "read_query")
+		assert.ErrorContains(t, err, "the server allows 1 calls at the same time")
+		release()
+		_, err = r.acquire(alice, "read_query")
+		assert.NoError(t, err)
+	})
+}
+
+func TestRateLimiterToolMiddleware(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.RateLimit.Client = config.RateLimitRule{RequestsPerMinute: 1}
+	r, err := NewRateLimiter(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+
+	calls := 0
+	handler := r.ToolMiddleware()(func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		calls++
+		return mcp.NewToolResultText("ok"), nil
+	})
+	request := mcp.CallToolRequest{}
+	request.Params.Name = "read_query"
+
+	result, err := handler(context.Background(), request)
+	assert.NoError(t, err)
+	assert.False(t, result.IsError)
+
+	result, err = handler(context.Background(), request)
+	assert.NoError(t, err)
+	assert.True(t, result.IsError)
+	if text, ok := mcp.AsTextContent(result.Content[0]); assert.True(t, ok) {
+		assert.Contains(t, text.Text, "rate limited, retry after")
+	}
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// QueryOptions controls how a read is executed and rendered
+type QueryOptions struct {
+	MaxRows        int
+	MaxResultBytes int
+	// Format is the output format name, see FormatNames
+	Format string
+	// NullValue is how NULL is written in text formats
+	NullValue string
+	// Values converts scanned values by column type. Nil uses hex for binary data and UTC
+	Values *ValueConverter
+	// Cursors keeps truncated results open for fetch_more. Nil disables cursors
+	Cursors *CursorStore
+	// CursorOwner is the MCP session that the cursors of the result belong to
+	CursorOwner string
+}
+
+// NewQueryOptions - Build the options for a read from the configuration and the tool call arguments
+func NewQueryOptions(cfg *config.Config, request mcp.CallToolRequest) QueryOptions {
+	opts := QueryOptions{
+		MaxRows:        cfg.Query.MaxRows,
+		MaxResultBytes: cfg.Query.MaxResultBytes,
+		Format:         request.GetString("format", cfg.Query.Format),
+		NullValue:      cfg.Query.NullValue,
+	}
+
+	// A per-call max_rows may lower the configured limit but never raise it
+	if maxRows := request.GetInt("max_rows", 0); maxRows > 0 && (opts.MaxRows == 0 || maxRows < opts.MaxRows) {
+		opts.MaxRows = maxRows
+	}
+
+	return opts
+}
+
+// valueConverter returns opts.Values, or the default converter when it is not set
+func (o QueryOptions) valueConverter() *ValueConverter {
+	if o.Values != nil {
+		return o.Values
+	}
+	return &ValueConverter{BinaryEncoding: BinaryEncodingHex, Location: time.UTC}
+}
+
+// ColumnInfo describes a result column
+type ColumnInfo struct {
+	Name string `json:"name"`
+	// Type is the MySQL type name, e.g. INT, VARCHAR or DECIMAL
+	Type     string `json:"type"`
+	Nullable bool   `json:"nullable"`
+	// Masked is the masking mode applied to the values of the column, if any
+	Masked string `json:"masked,omitempty"`
+}
+
+// QueryResult holds the scanned rows of a read
+type QueryResult struct {
+	Columns []ColumnInfo
+	Rows    []map[string]interface{}
+	// Truncated is set when scanning stopped at MaxRows and more rows were available
+	Truncated bool
+	MaxRows   int
+	// Cursor is the fetch_more token for the remaining rows, if any
+	Cursor string
+	// cursorMaxRows is set on the last page of a cursor that stopped at query.cursor_max_rows
+	cursorMaxRows int
+	// Elapsed is the time spent executing the query and scanning the rows
+	Elapsed time.Duration
+	// Warnings describes the parts of the query plan over an explain limit in warn mode
+	Warnings   []string
+	connection string
+}
+
+// ColumnNames returns the names of the result columns in order
+func (r *QueryResult) ColumnNames() []string {
+	names := make([]string, len(r.Columns))
+	for i, col := range r.Columns {
+		names[i] = col.Name
+	}
+	return names
+}
+
+// maskedColumns describes the masked columns of a result as `name (mode)`
+func maskedColumns(columns []ColumnInfo) []string {
+	masked := []string{}
+	for _, col := range columns {
+		if col.Masked != "" {
+			masked = append(masked, fmt.Sprintf("%s (%s)", col.Name, col.Masked))
+		}
+	}
+	return masked
+}
+
+// RenderResult renders the result in opts.Format, dropping trailing rows to fit opts.MaxResultBytes,
+// and appends a note when the rows shown are not the complete result. With cursors enabled,
+// dropped rows are kept for fetch_more and the note carries the cursor token
+func RenderResult(result *QueryResult, opts QueryOptions) (string, error) {
+	formatter, err := GetFormatter(opts.Format, FormatOptions{NullValue: opts.NullValue})
+	if err != nil {
+		return "", err
+	}
+
+	cols := result.ColumnNames()
+	s, err := formatter.Format(cols, result.Rows)
+	if err != nil {
+		return "", err
+	}
+
+	shown := len(result.Rows)
+	cut := false
+	if opts.MaxResultBytes > 0 && len(s) > opts.MaxResultBytes {
+		// Find the largest prefix of rows whose rendering still fits
+		var renderErr error
+		shown = sort.Search(len(result.Rows)+1, func(i int) bool {
+			out, err := formatter.Format(cols, result.Rows[:i])
+			if err != nil {
+				renderErr = err
+				return true
+			}
+			return len(out) > opts.MaxResultBytes
+		}) - 1
+		if renderErr != nil {
+			return "", renderErr
+		}
+		if shown < 0 {
+			shown = 0
+		}
+
+		s, err = formatter.Format(cols, result.Rows[:shown])
+		if err != nil {
+			return "", err
+		}
+
+		// Rows that did not fit are handed to the cursor so fetch_more returns them next
+		if opts.Cursors != nil {
+			token, err := opts.Cursors.Unread(result.Cursor, opts.CursorOwner, result.connection, result.Columns, result.Rows[shown:])
+			if err == nil {
+				result.Cursor = token
+			}
+		}
+		if result.Cursor == "" {
+			s += fmt.Sprintf("[truncated: %d of %d scanned rows returned, output limited to max_result_bytes=%d]\n",
+				shown, len(result.Rows), opts.MaxResultBytes)
+		}
+		cut = shown < len(result.Rows)
+		result.Rows = result.Rows[:shown]
+	}
+
+	switch {
+	case result.Cursor != "":
+		s += fmt.Sprintf("[truncated: %d rows returned, more rows are available. Call fetch_more with cursor %q to continue]\n",
+			shown, result.Cursor)
+	case result.Truncated && result.cursorMaxRows > 0:
+		s += fmt.Sprintf("[truncated: %d rows returned, the query has more rows than fetch_more keeps (cursor_max_rows=%d)]\n",
+			shown, result.cursorMaxRows)
+	case result.Truncated:
+		s += fmt.Sprintf("[truncated: %d rows returned, the query has more rows than max_rows=%d]\n",
+			shown, result.MaxRows)
+	}
+
+	if masked := maskedColumns(result.Columns); len(masked) > 0 {
+		s += fmt.Sprintf("[masked: %s]\n", strings.Join(masked, ", "))
+	}
+	for _, warning := range result.Warnings {
+		s += fmt.Sprintf("[warning: %s]\n", warning)
+	}
+
+	// The rows left in result are the ones shown, so they are not the complete result either
+	if cut {
+		result.Truncated = true
+	}
+
+	return s, nil
+}
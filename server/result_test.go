@@ -0,0 +1,88 @@
+package server
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewQueryOptions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Query.MaxRows = 100
+	cfg.Query.MaxResultBytes = 2048
+
+	newRequest := func(args map[string]any) mcp.CallToolRequest {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = args
+		return request
+	}
+
+	t.Run("configured defaults", func(t *testing.T) {
+		opts := NewQueryOptions(cfg, newRequest(nil))
+		assert.Equal(t, QueryOptions{MaxRows: 100, MaxResultBytes: 2048}, opts)
+	})
+
+	t.Run("per-call limit below the configured one", func(t *testing.T) {
+		opts := NewQueryOptions(cfg, newRequest(map[string]any{"max_rows": float64(10)}))
+		assert.Equal(t, 10, opts.MaxRows)
+	})
+
+	t.Run("per-call limit cannot raise the configured one", func(t *testing.T) {
+		opts := NewQueryOptions(cfg, newRequest(map[string]any{"max_rows": float64(5000)}))
+		assert.Equal(t, 100, opts.MaxRows)
+	})
+
+	t.Run("per-call limit when unlimited", func(t *testing.T) {
+		unlimited := &config.Config{}
+		opts := NewQueryOptions(unlimited, newRequest(map[string]any{"max_rows": float64(5000)}))
+		assert.Equal(t, 5000, opts.MaxRows)
+	})
+}
+
+func TestRenderResult(t *testing.T) {
+	newResult := func(n int) *QueryResult {
+		result := &QueryResult{Columns: []ColumnInfo{{Name: "id"}, {Name: "name"}}}
+		for i := 0; i < n; i++ {
+			result.Rows = append(result.Rows, map[string]interface{}{"id": i, "name": "row"})
+		}
+		return result
+	}
+
+	t.Run("complete result", func(t *testing.T) {
+		s, err := RenderResult(newResult(2), QueryOptions{})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n0,row\n1,row\n", s)
+	})
+
+	t.Run("truncated by max_rows", func(t *testing.T) {
+		result := newResult(2)
+		result.Truncated = true
+		result.MaxRows = 2
+
+		s, err := RenderResult(result, QueryOptions{MaxRows: 2})
+		assert.NoError(t, err)
+		assert.Equal(t, "id,name\n0,row\n1,row\n[truncated: 2 rows returned, the query has more rows than max_rows=2]\n", s)
+	})
+
+	t.Run("truncated by max_result_bytes", func(t *testing.T) {
+		// The header is 8 bytes and each row 6 bytes
+		s, err := RenderResult(newResult(10), QueryOptions{MaxResultBytes: 20})
+		assert.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(s), "\n")
+		assert.Equal(t, []string{
+			"id,name",
+			"0,row",
+			"1,row",
+			"[truncated: 2 of 10 scanned rows returned, output limited to max_result_bytes=20]",
+		}, lines)
+	})
+
+	t.Run("header does not fit", func(t *testing.T) {
+		s, err := RenderResult(newResult(3), QueryOptions{MaxResultBytes: 4})
+		assert.NoError(t, err)
+		assert.Contains(t, s, "[truncated: 0 of 3 scanned rows returned")
+	})
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"go.uber.org/zap"
+)
+
+// killTimeout bounds the KILL QUERY issued for a canceled statement
+const killTimeout = 5 * time.Second
+
+// QuerySession is the MySQL session a statement runs on. Its statement can be interrupted
+// from another connection with KILL QUERY, so cancellation also stops the work on the server
+type QuerySession struct {
+	id int64
+	// killDB is the pool used to issue KILL QUERY
+	killDB *sqlx.DB
+	// ctx is used for the DB calls of the statement. It is not canceled with the request that started it,
+	// only by Interrupt once KILL QUERY was sent, or by Close
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// NewQuerySession - Look up the connection id of the session q runs on
+func NewQuerySession(ctx context.Context, q sqlx.QueryerContext, killDB *sqlx.DB) (*QuerySession, error) {
+	var id int64
+	if err := q.QueryRowxContext(ctx, "SELECT CONNECTION_ID()").Scan(&id); err != nil {
+		return nil, fmt.Errorf("failed to get connection id: %v", err)
+	}
+
+	sessionCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	return &QuerySession{id: id, killDB: killDB, ctx: sessionCtx, cancel: cancel}, nil
+}
+
+// Watch interrupts the session's statement once ctx is done. Call the returned function
+// when the statement has finished to stop watching
+func (s *QuerySession) Watch(ctx context.Context) func() bool {
+	return context.AfterFunc(ctx, s.Interrupt)
+}
+
+// Interrupt kills the running statement on the server and aborts it on the client
+func (s *QuerySession) Interrupt() {
+	ctx, cancel := context.WithTimeout(context.Background(), killTimeout)
+	defer cancel()
+
+	// KILL does not accept placeholders; the id is an integer we read from the server
+	if _, err := s.killDB.ExecContext(ctx, fmt.Sprintf("KILL QUERY %d", s.id)); err != nil {
+		zap.S().Warnw("failed to kill query", "connection_id", s.id, "error", err)
+	} else {
+		zap.S().Infow("killed query", "connection_id", s.id)
+	}
+	s.cancel()
+}
+
+// Close releases the session context
+func (s *QuerySession) Close() {
+	s.cancel()
+}
+
+// statementContext bounds ctx by the connection's statement timeout
+func statementContext(ctx context.Context, conn *Connection) (context.Context, context.CancelFunc) {
+	if conn.Timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, conn.Timeout)
+}
+
+// maxExecutionTime returns the time left until the deadline of ctx in milliseconds,
+// for the max_execution_time session variable. 0 means no limit
+func maxExecutionTime(ctx context.Context) int64 {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0
+	}
+	// max_execution_time=0 would disable the limit, so never go below 1ms
+	return max(time.Until(deadline).Milliseconds(), 1)
+}
+
+// limitExecutionTime sets the session's statement time limit to the rest of ctx, so the server stops
+// a SELECT on its own too in case the KILL QUERY cannot be sent. MySQL calls it max_execution_time,
+// in milliseconds, and MariaDB max_statement_time, in seconds. Servers with neither run without it.
+// The returned function restores the default, so the limit does not stay on the pooled connection
+func limitExecutionTime(ctx context.Context, e sqlx.ExecerContext) (func(), error) {
+	ms := maxExecutionTime(ctx)
+	if ms == 0 {
+		return func() {}, nil
+	}
+
+	variable := "max_execution_time"
+	_, err := e.ExecContext(ctx, fmt.Sprintf("SET SESSION max_execution_time = %d", ms))
+	if isUnknownVariable(err) {
+		variable = "max_statement_time"
+		_, err = e.ExecContext(ctx, fmt.Sprintf("SET SESSION max_statement_time = %.3f", float64(ms)/1000))
+	}
+	if isUnknownVariable(err) {
+		return func() {}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return func() {
+		// ctx may have ended with the statement, the reset must still reach the server
+		resetCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), killTimeout)
+		defer cancel()
+		if _, err := e.ExecContext(resetCtx, "SET SESSION "+variable+" = DEFAULT"); err != nil {
+			zap.S().Warnw("failed to reset the statement time limit", "variable", variable, "error", err)
+		}
+	}, nil
+}
+
+// isUnknownVariable reports whether err is the error of setting a system variable the server does not have
+func isUnknownVariable(err error) bool {
+	var mysqlErr *mysql.MySQLError
+	return errors.As(err, &mysqlErr) && mysqlErr.Number == errUnknownSystemVariable
+}
+
+// errUnknownSystemVariable is ER_UNKNOWN_SYSTEM_VARIABLE
+const errUnknownSystemVariable = 1193
+
+// statementError explains a failure caused by ctx ending before the statement finished
+func statementError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("statement timed out and was killed: %v", err)
+	case errors.Is(ctx.Err(), context.Canceled):
+		return fmt.Errorf("statement was canceled and killed: %v", err)
+	default:
+		return err
+	}
+}
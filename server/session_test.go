@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatementContext(t *testing.T) {
+	t.Run("with timeout", func(t *testing.T) {
+		ctx, cancel := statementContext(context.Background(), &Connection{Timeout: time.Minute})
+		defer cancel()
+		deadline, ok := ctx.Deadline()
+		assert.True(t, ok)
+		assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+	})
+
+	t.Run("without timeout", func(t *testing.T) {
+		ctx, cancel := statementContext(context.Background(), &Connection{})
+		defer cancel()
+		_, ok := ctx.Deadline()
+		assert.False(t, ok)
+	})
+}
+
+func TestMaxExecutionTime(t *testing.T) {
+	t.Run("no deadline", func(t *testing.T) {
+		assert.Equal(t, int64(0), maxExecutionTime(context.Background()))
+	})
+
+	t.Run("remaining time", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		ms := maxExecutionTime(ctx)
+		assert.Greater(t, ms, int64(9000))
+		assert.LessOrEqual(t, ms, int64(10000))
+	})
+
+	t.Run("expired deadline", func(t *testing.T) {
+		// Never 0, which would disable the limit
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		assert.Equal(t, int64(1), maxExecutionTime(ctx))
+	})
+}
+
+// recordingExecer records the statements sent to it and fails those that set an unknown variable
+type recordingExecer struct {
+	unknown    []string
+	statements []string
+}
+
+func (e *recordingExecer) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	e.statements = append(e.statements, query)
+	for _, variable := range e.unknown {
+		if strings.HasPrefix(query, "SET SESSION "+variable+" =") {
+			return nil, &mysql.MySQLError{Number: errUnknownSystemVariable, Message: "Unknown system variable '" + variable + "'"}
+		}
+	}
+	return nil, nil
+}
+
+func TestLimitExecutionTime(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	t.Run("mysql", func(t *testing.T) {
+		e := &recordingExecer{}
+		restore, err := limitExecutionTime(ctx, e)
+		assert.NoError(t, err)
+		assert.Regexp(t, `^SET SESSION max_execution_time = \d+$`, e.statements[0])
+		restore()
+		assert.Equal(t, "SET SESSION max_execution_time = DEFAULT", e.statements[1])
+	})
+
+	t.Run("mariadb", func(t *testing.T) {
+		e := &recordingExecer{unknown: []string{"max_execution_time"}}
+		restore, err := limitExecutionTime(ctx, e)
+		assert.NoError(t, err)
+		assert.Regexp(t, `^SET SESSION max_statement_time = \d+\.\d{3}$`, e.statements[1])
+		restore()
+		assert.Equal(t, "SET SESSION max_statement_time = DEFAULT", e.statements[2])
+	})
+
+	t.Run("neither variable", func(t *testing.T) {
+		e := &recordingExecer{unknown: []string{"max_execution_time", "max_statement_time"}}
+		restore, err := limitExecutionTime(ctx, e)
+		assert.NoError(t, err)
+		restore()
+		assert.Len(t, e.statements, 2)
+	})
+
+	t.Run("no deadline", func(t *testing.T) {
+		e := &recordingExecer{}
+		restore, err := limitExecutionTime(context.Background(), e)
+		assert.NoError(t, err)
+		restore()
+		assert.Empty(t, e.statements)
+	})
+}
+
+func TestStatementError(t *testing.T) {
+	queryErr := fmt.Errorf("Error 1317: Query execution was interrupted")
+
+	t.Run("timeout", func(t *testing.T) {
+		ctx, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+		defer cancel()
+		err := statementError(ctx, queryErr)
+		assert.Contains(t, err.Error(), "timed out")
+		assert.Contains(t, err.Error(), "interrupted")
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.Contains(t, statementError(ctx, queryErr).Error(), "canceled")
+	})
+
+	t.Run("context still active", func(t *testing.T) {
+		assert.Equal(t, queryErr, statementError(context.Background(), queryErr))
+	})
+}
@@ -0,0 +1,244 @@
+package server
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/pingcap/tidb/pkg/parser"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/opcode"
+
+	// The parser needs a value driver to build literals and parameter markers
+	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
+// allowedStatementTypes lists the statement kinds each tool's expected statement type accepts
+var allowedStatementTypes = map[string][]string{
+	StatementTypeSelect:      {StatementTypeSelect, StatementTypeShow, StatementTypeExplain},
+	StatementTypeInsert:      {StatementTypeInsert},
+	StatementTypeUpdate:      {StatementTypeUpdate},
+	StatementTypeDelete:      {StatementTypeDelete},
+	StatementTypeCreateTable: {StatementTypeCreateTable},
+	StatementTypeAlterTable:  {StatementTypeAlterTable},
+}
+
+// restoreFlags write nodes back as SQL MySQL accepts, without the utf8mb4 introducer the parser adds to strings
+const restoreFlags = format.DefaultRestoreFlags | format.RestoreStringWithoutDefaultCharset
+
+// Parsers are not safe for concurrent use, so each call borrows one from the pool
+var parserPool = sync.Pool{
+	New: func() any { return parser.New() },
+}
+
+// Statement is a single parsed and classified SQL statement
+type Statement struct {
+	Kind string
+	Text string
+	Node ast.StmtNode
+}
+
+// ParseStatement parses the query and requires it to contain exactly one statement
+func ParseStatement(query string) (*Statement, error) {
+	p := parserPool.Get().(*parser.Parser)
+	defer parserPool.Put(p)
+
+	nodes, _, err := p.Parse(query, "", "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse SQL: %v", err)
+	}
+
+	switch len(nodes) {
+	case 0:
+		return nil, fmt.Errorf("no SQL statement found")
+	case 1:
+	default:
+		return nil, fmt.Errorf("multiple statements are not allowed, found %d: statement 2 is %s %q",
+			len(nodes), ClassifyStatement(nodes[1]), strings.TrimSpace(nodes[1].Text()))
+	}
+
+	return &Statement{
+		Kind: ClassifyStatement(nodes[0]),
+		Text: strings.TrimSpace(nodes[0].Text()),
+		Node: nodes[0],
+	}, nil
+}
+
+// CheckStatement parses the query and verifies that its kind is accepted for the expected statement type
+func CheckStatement(query, expect string) (*Statement, error) {
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, ok := allowedStatementTypes[expect]
+	if !ok {
+		return nil, fmt.Errorf("unknown statement type %q", expect)
+	}
+
+	for _, kind := range allowed {
+		if stmt.Kind == kind {
+			return stmt, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s statement %q is not allowed here, expected %s",
+		stmt.Kind, stmt.Text, strings.Join(allowed, " or "))
+}
+
+// CheckWhere requires an UPDATE or DELETE to have a WHERE clause that restricts the rows it changes.
+// Conditions without a column, such as 1=1, and conditions that hold for every row, such as id=id,
+// are rejected. Other statements pass
+func CheckWhere(stmt *Statement) error {
+	var where ast.ExprNode
+	switch n := stmt.Node.(type) {
+	case *ast.UpdateStmt:
+		where = n.Where
+	case *ast.DeleteStmt:
+		where = n.Where
+	default:
+		return nil
+	}
+
+	if where == nil {
+		return fmt.Errorf("%s without a WHERE clause is not allowed", stmt.Kind)
+	}
+	if matchesEveryRow(where) {
+		return fmt.Errorf("%s with a WHERE clause that does not restrict the rows is not allowed: %s", stmt.Kind, restoreNode(where))
+	}
+	return nil
+}
+
+// matchesEveryRow reports whether a condition may hold regardless of the row it is evaluated on
+func matchesEveryRow(expr ast.ExprNode) bool {
+	switch e := expr.(type) {
+	case *ast.ParenthesesExpr:
+		return matchesEveryRow(e.Expr)
+	case *ast.BinaryOperationExpr:
+		switch e.Op {
+		case opcode.LogicOr:
+			return matchesEveryRow(e.L) || matchesEveryRow(e.R)
+		case opcode.LogicAnd:
+			return matchesEveryRow(e.L) && matchesEveryRow(e.R)
+		case opcode.EQ, opcode.NullEQ, opcode.GE, opcode.LE:
+			// A column compared with itself, e.g. id = id
+			if l, ok := e.L.(*ast.ColumnNameExpr); ok {
+				if r, ok := e.R.(*ast.ColumnNameExpr); ok && strings.EqualFold(restoreNode(l), restoreNode(r)) {
+					return true
+				}
+			}
+		}
+	case *ast.PatternLikeOrIlikeExpr:
+		// LIKE '%' matches every non-NULL value
+		if pattern := restoreNode(e.Pattern); !e.Not && len(pattern) > 2 && strings.Trim(pattern, "'%") == "" {
+			return true
+		}
+	}
+	return !referencesColumn(expr)
+}
+
+// referencesColumn reports whether a column appears anywhere in node, including subqueries
+func referencesColumn(node ast.Node) bool {
+	finder := &columnFinder{}
+	node.Accept(finder)
+	return finder.found
+}
+
+type columnFinder struct {
+	found bool
+}
+
+func (f *columnFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if _, ok := n.(*ast.ColumnNameExpr); ok {
+		f.found = true
+	}
+	return n, f.found
+}
+
+func (f *columnFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// restoreNode writes a node back as SQL, for messages and comparisons
+func restoreNode(node ast.Node) string {
+	var b strings.Builder
+	if err := node.Restore(format.NewRestoreCtx(restoreFlags, &b)); err != nil {
+		return fmt.Sprintf("%T", node)
+	}
+	return b.String()
+}
+
+// ClassifyStatement returns the SQL kind of a parsed statement, e.g. SELECT, ALTER TABLE or CALL.
+// Reads that lock rows or write their results somewhere are reported as their own kinds
+func ClassifyStatement(node ast.StmtNode) string {
+	switch n := node.(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		if kind := selectSideEffect(n); kind != "" {
+			return kind
+		}
+		return StatementTypeSelect
+	case *ast.InsertStmt:
+		if n.IsReplace {
+			return "REPLACE"
+		}
+		return StatementTypeInsert
+	case *ast.ExplainStmt:
+		if n.Analyze {
+			return "EXPLAIN ANALYZE"
+		}
+		return StatementTypeExplain
+	case *ast.DropTableStmt:
+		if n.IsView {
+			return "DROP VIEW"
+		}
+		return "DROP TABLE"
+	}
+
+	return statementName(node)
+}
+
+// selectSideEffect finds locking or INTO clauses anywhere in a SELECT, including subqueries and unions
+func selectSideEffect(node ast.Node) string {
+	finder := &selectSideEffectFinder{}
+	node.Accept(finder)
+	return finder.kind
+}
+
+type selectSideEffectFinder struct {
+	kind string
+}
+
+func (f *selectSideEffectFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if sel, ok := n.(*ast.SelectStmt); ok {
+		if sel.SelectIntoOpt != nil {
+			f.kind = "SELECT ... INTO"
+			return n, true
+		}
+		if sel.LockInfo != nil && sel.LockInfo.LockType != ast.SelectLockNone {
+			f.kind = "SELECT ... " + strings.ToUpper(sel.LockInfo.LockType.String())
+			return n, true
+		}
+	}
+	return n, f.kind != ""
+}
+
+func (f *selectSideEffectFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// statementName derives a kind from the AST type, e.g. *ast.DropProcedureStmt becomes DROP PROCEDURE
+func statementName(node ast.StmtNode) string {
+	name := strings.TrimSuffix(reflect.TypeOf(node).Elem().Name(), "Stmt")
+
+	var b strings.Builder
+	for i, r := range name {
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(rune(name[i-1])) {
+			b.WriteRune(' ')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+	}
+	return b.String()
+}
@@ -0,0 +1,146 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyStatement(t *testing.T) {
+	cases := map[string]string{
+		"SELECT * FROM t":                                           StatementTypeSelect,
+		"WITH a AS (SELECT 1) SELECT * FROM a":                      StatementTypeSelect,
+		"SELECT 1 UNION SELECT 2":                                   StatementTypeSelect,
+		"SELECT * FROM t FOR UPDATE":                                "SELECT ... FOR UPDATE",
+		"SELECT * FROM t LOCK IN SHARE MODE":                        "SELECT ... FOR SHARE",
+		"SELECT * FROM t WHERE id IN (SELECT id FROM u FOR UPDATE)": "SELECT ... FOR UPDATE",
+		"SELECT 1 INTO OUTFILE '/tmp/x'":                            "SELECT ... INTO",
+		"SHOW TABLES":                                               StatementTypeShow,
+		"DESC t":                                                    StatementTypeExplain,
+		"EXPLAIN SELECT 1":                                          StatementTypeExplain,
+		"EXPLAIN ANALYZE SELECT 1":                                  "EXPLAIN ANALYZE",
+		"INSERT INTO t VALUES (1)":                                  StatementTypeInsert,
+		"REPLACE INTO t VALUES (1)":                                 "REPLACE",
+		"UPDATE t SET a = 1 WHERE id = 1":                           StatementTypeUpdate,
+		"DELETE FROM t WHERE id = 1":                                StatementTypeDelete,
+		"CREATE TABLE t (id INT)":                                   StatementTypeCreateTable,
+		"ALTER TABLE t ADD COLUMN c INT":                            StatementTypeAlterTable,
+		"DROP TABLE t":                                              "DROP TABLE",
+		"DROP VIEW v":                                               "DROP VIEW",
+		"TRUNCATE TABLE t":                                          "TRUNCATE TABLE",
+		"CALL do_something()":                                       "CALL",
+	}
+
+	for query, expected := range cases {
+		stmt, err := ParseStatement(query)
+		if assert.NoError(t, err, query) {
+			assert.Equal(t, expected, stmt.Kind, query)
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	t.Run("trailing semicolon is a single statement", func(t *testing.T) {
+		stmt, err := ParseStatement("SELECT 1;")
+		assert.NoError(t, err)
+		assert.Equal(t, StatementTypeSelect, stmt.Kind)
+	})
+
+	t.Run("multiple statements", func(t *testing.T) {
+		_, err := ParseStatement("SELECT 1; DELETE FROM t")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "multiple statements are not allowed")
+		assert.Contains(t, err.Error(), `statement 2 is DELETE "DELETE FROM t"`)
+	})
+
+	t.Run("empty query", func(t *testing.T) {
+		_, err := ParseStatement("  ")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "no SQL statement found")
+	})
+
+	t.Run("syntax error", func(t *testing.T) {
+		_, err := ParseStatement("SELEC 1")
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "failed to parse SQL")
+	})
+}
+
+func TestCheckStatement(t *testing.T) {
+	t.Run("matching kinds", func(t *testing.T) {
+		for query, expect := range map[string]string{
+			"SELECT 1":                        StatementTypeSelect,
+			"SHOW DATABASES":                  StatementTypeSelect,
+			"INSERT INTO t VALUES (1)":        StatementTypeInsert,
+			"UPDATE t SET a = 1 WHERE id = 1": StatementTypeUpdate,
+			"DELETE FROM t WHERE id = 1":      StatementTypeDelete,
+			"CREATE TABLE t (id INT)":         StatementTypeCreateTable,
+			"ALTER TABLE t ADD COLUMN c INT":  StatementTypeAlterTable,
+		} {
+			_, err := CheckStatement(query, expect)
+			assert.NoError(t, err, query)
+		}
+	})
+
+	t.Run("locking read in read_query", func(t *testing.T) {
+		_, err := CheckStatement("SELECT * FROM t FOR UPDATE", StatementTypeSelect)
+		assert.Error(t, err)
+		assert.Equal(t, `SELECT ... FOR UPDATE statement "SELECT * FROM t FOR UPDATE" is not allowed here, expected SELECT or SHOW or EXPLAIN`, err.Error())
+	})
+
+	t.Run("stored procedure in read_query", func(t *testing.T) {
+		_, err := CheckStatement("CALL do_cleanup()", StatementTypeSelect)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `CALL statement "CALL do_cleanup()"`)
+	})
+
+	t.Run("wrong DML kind", func(t *testing.T) {
+		_, err := CheckStatement("DELETE FROM t", StatementTypeUpdate)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), "expected UPDATE")
+	})
+
+	t.Run("DDL in alter_table", func(t *testing.T) {
+		_, err := CheckStatement("DROP TABLE t", StatementTypeAlterTable)
+		assert.Error(t, err)
+		assert.Contains(t, err.Error(), `DROP TABLE statement "DROP TABLE t"`)
+	})
+}
+
+func TestCheckWhere(t *testing.T) {
+	check := func(query string) error {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err, query) {
+			t.FailNow()
+		}
+		return CheckWhere(stmt)
+	}
+
+	allowed := []string{
+		"UPDATE users SET name = 'x' WHERE id = 1",
+		"DELETE FROM users WHERE id = ? AND status = ?",
+		"DELETE FROM users WHERE 1 = 1 AND id = 5",
+		"UPDATE users SET active = 0 WHERE id IN (SELECT user_id FROM bans)",
+		"DELETE FROM users WHERE name LIKE 'a%'",
+		"INSERT INTO users (name) VALUES ('x')",
+	}
+	for _, query := range allowed {
+		assert.NoError(t, check(query), query)
+	}
+
+	rejected := map[string]string{
+		"UPDATE users SET name = 'x'":                  "UPDATE without a WHERE clause",
+		"DELETE FROM users":                            "DELETE without a WHERE clause",
+		"DELETE FROM users WHERE 1=1":                  "does not restrict the rows is not allowed: 1=1",
+		"DELETE FROM users WHERE TRUE":                 "does not restrict the rows",
+		"UPDATE users SET a = 1 WHERE ? = ?":           "does not restrict the rows",
+		"DELETE FROM users WHERE id = 5 OR 1 = 1":      "does not restrict the rows",
+		"DELETE FROM users WHERE (id = id)":            "does not restrict the rows",
+		"DELETE FROM users WHERE name LIKE '%'":        "does not restrict the rows",
+		"DELETE FROM users WHERE EXISTS (SELECT 1)":    "does not restrict the rows",
+		"UPDATE users SET a = 1 WHERE 1 = 1 AND 2 = 2": "does not restrict the rows",
+	}
+	for query, message := range rejected {
+		assert.ErrorContains(t, check(query), message, query)
+	}
+}
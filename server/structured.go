@@ -0,0 +1,59 @@
+package server
+
+import (
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// StructuredResult is the structured content of the read tools
+type StructuredResult struct {
+	Connection string `json:"connection"`
+	// Columns lists the result columns in order
+	Columns []ColumnInfo `json:"columns"`
+	// Rows holds the returned rows with typed values: numbers, strings or null
+	Rows     []map[string]interface{} `json:"rows"`
+	RowCount int                      `json:"row_count"`
+	// Truncated is set when the rows are not the complete result
+	Truncated bool `json:"truncated"`
+	// Cursor continues a truncated result with fetch_more
+	Cursor          string  `json:"cursor,omitempty"`
+	ExecutionTimeMs float64 `json:"execution_time_ms"`
+	// Warnings describes the parts of the query plan over an explain limit
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// TableDefinition is the structured content of desc_table
+type TableDefinition struct {
+	Connection  string `json:"connection"`
+	Database    string `json:"database"`
+	Table       string `json:"table"`
+	CreateTable string `json:"create_table"`
+}
+
+// NewStructuredResult - Build the structured content of a read result. Call it after RenderResult,
+// which drops the rows that did not fit the output limit
+func NewStructuredResult(result *QueryResult) StructuredResult {
+	rows := result.Rows
+	if rows == nil {
+		rows = []map[string]interface{}{}
+	}
+
+	return StructuredResult{
+		Connection:      result.connection,
+		Columns:         result.Columns,
+		Rows:            rows,
+		RowCount:        len(rows),
+		Truncated:       result.Truncated,
+		Cursor:          result.Cursor,
+		ExecutionTimeMs: float64(result.Elapsed.Microseconds()) / 1000,
+		Warnings:        result.Warnings,
+	}
+}
+
+// QueryToolResult renders a read result as the text content and returns it together with the structured content
+func QueryToolResult(result *QueryResult, opts QueryOptions) *mcp.CallToolResult {
+	text, err := RenderResult(result, opts)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error())
+	}
+	return mcp.NewToolResultStructured(NewStructuredResult(result), text)
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueryToolResult(t *testing.T) {
+	newResult := func() *QueryResult {
+		return &QueryResult{
+			Columns: []ColumnInfo{
+				{Name: "id", Type: "INT", Nullable: false},
+				{Name: "price", Type: "DECIMAL", Nullable: true},
+			},
+			Rows: []map[string]interface{}{
+				{"id": int64(1), "price": json.Number("9.99")},
+				{"id": int64(2), "price": nil},
+			},
+			Elapsed:    1500 * time.Microsecond,
+			connection: "default",
+		}
+	}
+
+	t.Run("text and structured content", func(t *testing.T) {
+		toolResult := QueryToolResult(newResult(), QueryOptions{NullValue: DefaultNullValue})
+		assert.False(t, toolResult.IsError)
+		assert.Equal(t, "id,price\n1,9.99\n2,NULL\n", toolResult.Content[0].(mcp.TextContent).Text)
+
+		structured := toolResult.StructuredContent.(StructuredResult)
+		assert.Equal(t, 2, structured.RowCount)
+		assert.False(t, structured.Truncated)
+		assert.Equal(t, 1.5, structured.ExecutionTimeMs)
+		assert.Equal(t, "DECIMAL", structured.Columns[1].Type)
+
+		// Values keep their JSON types
+		b, err := json.Marshal(structured.Rows)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `[{"id":1,"price":9.99},{"id":2,"price":null}]`, string(b))
+	})
+
+	t.Run("rows cut by max_result_bytes are marked truncated", func(t *testing.T) {
+		toolResult := QueryToolResult(newResult(), QueryOptions{MaxResultBytes: 17})
+		structured := toolResult.StructuredContent.(StructuredResult)
+		assert.Equal(t, 1, structured.RowCount)
+		assert.True(t, structured.Truncated)
+	})
+
+	t.Run("render error", func(t *testing.T) {
+		toolResult := QueryToolResult(newResult(), QueryOptions{Format: "xml"})
+		assert.True(t, toolResult.IsError)
+	})
+}
+
+func TestStructuredOutputSchema(t *testing.T) {
+	tool := mcp.NewTool("read_query", mcp.WithOutputSchema[StructuredResult]())
+	assert.Equal(t, "object", tool.OutputSchema.Type)
+	assert.Contains(t, tool.OutputSchema.Properties, "columns")
+	assert.Contains(t, tool.OutputSchema.Properties, "rows")
+	assert.Contains(t, tool.OutputSchema.Required, "row_count")
+	assert.NotContains(t, tool.OutputSchema.Required, "cursor")
+}
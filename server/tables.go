@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	TableTypeTable = "table"
+	TableTypeView  = "view"
+)
+
+// TableFilter selects the tables list_table returns
+type TableFilter struct {
+	// Database defaults to the database of the connection
+	Database string
+	// Pattern is a LIKE pattern of the table names, or a regular expression when Regex is set
+	Pattern string
+	Regex   bool
+	// Type is TableTypeTable, TableTypeView or empty for both
+	Type string
+}
+
+// listTablesColumns are the columns of list_table, read from information_schema.TABLES.
+// approximate_rows is the estimate of the storage engine, exact only for MyISAM
+const listTablesColumns = "TABLE_SCHEMA AS `database`, TABLE_NAME AS `table`, TABLE_TYPE AS `type`, ENGINE AS `engine`, " +
+	"TABLE_ROWS AS `approximate_rows`, DATA_LENGTH AS `data_length`, INDEX_LENGTH AS `index_length`, " +
+	"CREATE_TIME AS `create_time`, UPDATE_TIME AS `update_time`, TABLE_COMMENT AS `comment`"
+
+// HandleListTables lists the tables of a database that match the filter, with their type, engine,
+// approximate row count, sizes, times and comment. Tables hidden by access rules are left out
+func HandleListTables(ctx context.Context, conn *Connection, filter TableFilter, opts QueryOptions) (*QueryResult, error) {
+	database := conn.Database
+	if filter.Database != "" {
+		var err error
+		if database, err = ParseIdentifier(filter.Database); err != nil {
+			return nil, fmt.Errorf("invalid database: %v", err)
+		}
+	}
+	if database == "" {
+		return nil, fmt.Errorf("no database selected, pass database to list its tables")
+	}
+	if !conn.Access.DatabaseAllowed(database) {
+		return nil, fmt.Errorf("access denied: database %s is not allowed", quoteIdentifier(database))
+	}
+
+	// Hidden tables are excluded by the query, so they do not count towards max_rows
+	hidden, err := hiddenTables(ctx, conn, database)
+	if err != nil {
+		return nil, err
+	}
+	query, args, err := listTablesQuery(database, filter, hidden)
+	if err != nil {
+		return nil, err
+	}
+	result, err := DoQuery(ctx, conn, query, StatementTypeNoExplainCheck, args, opts)
+	if err != nil {
+		return nil, err
+	}
+	// Tables created since hiddenTables ran are still left out
+	conn.Access.FilterTables(result)
+	return result, nil
+}
+
+// hiddenTables returns the names of the tables of a database that access rules hide
+func hiddenTables(ctx context.Context, conn *Connection, database string) ([]string, error) {
+	if !conn.Access.Enabled() {
+		return nil, nil
+	}
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
+
+	names := []string{}
+	if err := conn.ReadDB.SelectContext(ctx, &names, "SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = ?", database); err != nil {
+		return nil, statementError(ctx, err)
+	}
+	hidden := []string{}
+	for _, name := range names {
+		if !conn.Access.TableAllowed(database, name) {
+			hidden = append(hidden, name)
+		}
+	}
+	return hidden, nil
+}
+
+// listTablesQuery builds the information_schema.TABLES query of a filter, with the values bound as parameters.
+// The hidden tables are excluded
+func listTablesQuery(database string, filter TableFilter, hidden []string) (string, []interface{}, error) {
+	conditions := []string{"TABLE_SCHEMA = ?"}
+	args := []interface{}{database}
+
+	switch {
+	case filter.Pattern == "":
+	case filter.Regex:
+		conditions = append(conditions, "TABLE_NAME REGEXP ?")
+		args = append(args, filter.Pattern)
+	default:
+		conditions = append(conditions, "TABLE_NAME LIKE ?")
+		args = append(args, filter.Pattern)
+	}
+
+	switch filter.Type {
+	case "":
+	case TableTypeTable:
+		// MariaDB reports tables with system versioning as their own type
+		conditions = append(conditions, "TABLE_TYPE IN ('BASE TABLE', 'SYSTEM VERSIONED')")
+	case TableTypeView:
+		conditions = append(conditions, "TABLE_TYPE IN ('VIEW', 'SYSTEM VIEW')")
+	default:
+		return "", nil, fmt.Errorf("unknown table type %q, expected %q or %q", filter.Type, TableTypeTable, TableTypeView)
+	}
+
+	if len(hidden) > 0 {
+		conditions = append(conditions, "TABLE_NAME NOT IN (?"+strings.Repeat(", ?", len(hidden)-1)+")")
+		for _, name := range hidden {
+			args = append(args, name)
+		}
+	}
+
+	query := fmt.Sprintf("SELECT %s FROM information_schema.TABLES WHERE %s ORDER BY TABLE_NAME",
+		listTablesColumns, strings.Join(conditions, " AND "))
+	return query, args, nil
+}
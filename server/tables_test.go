@@ -0,0 +1,64 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTablesQuery(t *testing.T) {
+	t.Run("all tables", func(t *testing.T) {
+		query, args, err := listTablesQuery("shop", TableFilter{}, nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "SELECT "+listTablesColumns+" FROM information_schema.TABLES WHERE TABLE_SCHEMA = ? ORDER BY TABLE_NAME", query)
+		assert.Equal(t, []interface{}{"shop"}, args)
+	})
+
+	t.Run("like pattern and views", func(t *testing.T) {
+		query, args, err := listTablesQuery("shop", TableFilter{Pattern: "order%", Type: TableTypeView}, nil)
+		assert.NoError(t, err)
+		assert.Contains(t, query, "WHERE TABLE_SCHEMA = ? AND TABLE_NAME LIKE ? AND TABLE_TYPE IN ('VIEW', 'SYSTEM VIEW')")
+		assert.Equal(t, []interface{}{"shop", "order%"}, args)
+	})
+
+	t.Run("regex and base tables", func(t *testing.T) {
+		query, args, err := listTablesQuery("shop", TableFilter{Pattern: "^order_[0-9]+$", Regex: true, Type: TableTypeTable}, nil)
+		assert.NoError(t, err)
+		assert.Contains(t, query, "AND TABLE_NAME REGEXP ? AND TABLE_TYPE IN ('BASE TABLE', 'SYSTEM VERSIONED')")
+		assert.Equal(t, []interface{}{"shop", "^order_[0-9]+$"}, args)
+	})
+
+	t.Run("hidden tables", func(t *testing.T) {
+		query, args, err := listTablesQuery("shop", TableFilter{Pattern: "s%"}, []string{"secrets", "sessions"})
+		assert.NoError(t, err)
+		assert.Contains(t, query, "WHERE TABLE_SCHEMA = ? AND TABLE_NAME LIKE ? AND TABLE_NAME NOT IN (?, ?) ORDER BY TABLE_NAME")
+		assert.Equal(t, []interface{}{"shop", "s%", "secrets", "sessions"}, args)
+	})
+
+	t.Run("unknown type", func(t *testing.T) {
+		_, _, err := listTablesQuery("shop", TableFilter{Type: "sequence"}, nil)
+		assert.ErrorContains(t, err, `unknown table type "sequence"`)
+	})
+}
+
+func TestHandleListTablesRejectsBeforeQuerying(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Access.Rules = []config.AccessRule{{Action: AccessDeny, Database: "mysql"}}
+	access, err := NewAccessPolicy(cfg)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	// No database handle: every case must fail before a query is sent
+	conn := &Connection{Name: "default", Access: access}
+
+	_, err = HandleListTables(context.Background(), conn, TableFilter{}, QueryOptions{})
+	assert.ErrorContains(t, err, "no database selected")
+
+	_, err = HandleListTables(context.Background(), conn, TableFilter{Database: "shop; DROP TABLE users"}, QueryOptions{})
+	assert.ErrorContains(t, err, "invalid database")
+
+	_, err = HandleListTables(context.Background(), conn, TableFilter{Database: "mysql"}, QueryOptions{})
+	assert.EqualError(t, err, "access denied: database `mysql` is not allowed")
+}
@@ -2,21 +2,28 @@ package server
 
 import (
 	"context"
-	"encoding/csv"
+	"database/sql"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/cnosuke/mcp-mysql/config"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
 )
 
 const (
+	// StatementTypeNoExplainCheck marks trusted internal queries that skip statement checks
 	StatementTypeNoExplainCheck = ""
 	StatementTypeSelect         = "SELECT"
 	StatementTypeInsert         = "INSERT"
 	StatementTypeUpdate         = "UPDATE"
 	StatementTypeDelete         = "DELETE"
+	StatementTypeCreateTable    = "CREATE TABLE"
+	StatementTypeAlterTable     = "ALTER TABLE"
+	StatementTypeShow           = "SHOW"
+	StatementTypeExplain        = "EXPLAIN"
 )
 
 // ExplainResult represents the output of EXPLAIN query
@@ -42,22 +49,84 @@ type ShowCreateTableResult struct {
 }
 
 // RegisterAllTools - Register all tools with the server
-func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
+func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config, registry *Registry) error {
+	connectionParam := mcp.WithString("connection",
+		mcp.Description(fmt.Sprintf("Name of the connection profile to use. Defaults to the configured default connection. Available: %s", strings.Join(registry.Names(), ", "))),
+	)
+	if _, err := GetFormatter(cfg.Query.Format, FormatOptions{}); err != nil {
+		return err
+	}
+	values, err := NewValueConverter(cfg)
+	if err != nil {
+		return err
+	}
+	formatParam := mcp.WithString("format",
+		mcp.Description(fmt.Sprintf("Output format of the rows. Defaults to %s", cfg.Query.Format)),
+		mcp.Enum(FormatNames()...),
+	)
+	paramsParam := mcp.WithAny("params",
+		mcp.Description("Values bound to the query as real parameters instead of being written into the SQL. "+
+			"An array binds positional `?` markers in order, an object binds named `:name` markers"),
+		func(schema map[string]any) {
+			schema["type"] = []string{"array", "object"}
+		},
+	)
+	dsnParam := mcp.WithString("dsn",
+		mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
+	)
+	if !registry.ToolDSNAllowed() {
+		// Remote callers must not pick the servers this one connects to
+		dsnParam = func(*mcp.Tool) {}
+	}
+	readOnly := registry.AllReadOnly()
+	transactionParam := mcp.WithString("transaction_id",
+		mcp.Description("Run the statement inside a transaction started with `begin_transaction`. The transaction's connection is used, so omit `connection` and `dsn`"),
+	)
+	if readOnly {
+		// There is no begin_transaction tool to get an id from
+		transactionParam = func(*mcp.Tool) {}
+	}
+	dryRunParam := mcp.WithBoolean("dry_run",
+		mcp.Description(fmt.Sprintf("Run the statement in a transaction that is always rolled back and report the rows it would affect, "+
+			"with a sample of the rows it matches before and after. Defaults to %t", cfg.Write.DryRun)),
+	)
+	maxAffectedRowsParam := mcp.WithNumber("max_affected_rows",
+		mcp.Description(fmt.Sprintf("Refuse the statement if it would change more rows than this. Defaults to and cannot exceed the server limit (%d, 0 means unlimited)", cfg.Write.MaxAffectedRows)),
+	)
+	cursors := NewCursorStore(cfg.Query.CursorIdleTimeout, cfg.Query.MaxOpenCursors, cfg.Query.CursorMaxRows)
+	approver := NewApprover(cfg, mcpServer)
+
 	// Schema Tools
 	listDatabaseTool := mcp.NewTool(
 		"list_database",
 		mcp.WithDescription("List all databases in the MySQL server"),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
-		),
+		dsnParam,
+		formatParam,
+		connectionParam,
+		mcp.WithOutputSchema[StructuredResult](),
 	)
 
 	listTableTool := mcp.NewTool(
 		"list_table",
-		mcp.WithDescription("List all tables in the MySQL server"),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
+		mcp.WithDescription("List the tables and views of a database with their type, engine, approximate row count, data and index size, "+
+			"create and update time and comment"),
+		mcp.WithString("database",
+			mcp.Description("Database whose tables are listed. Defaults to the database of the connection"),
+		),
+		mcp.WithString("pattern",
+			mcp.Description("Only list tables whose name matches this LIKE pattern, such as `order%`, or regular expression when `regex` is true"),
+		),
+		mcp.WithBoolean("regex",
+			mcp.Description("Match `pattern` as a MySQL regular expression instead of a LIKE pattern"),
+		),
+		mcp.WithString("type",
+			mcp.Description("Only list base tables or only views. Defaults to both"),
+			mcp.Enum(TableTypeTable, TableTypeView),
 		),
+		dsnParam,
+		formatParam,
+		connectionParam,
+		mcp.WithOutputSchema[StructuredResult](),
 	)
 
 	createTableTool := mcp.NewTool(
@@ -67,21 +136,20 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 			mcp.Required(),
 			mcp.Description("The SQL query to create the table"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
-		),
+		dsnParam,
+		connectionParam,
 	)
 
 	alterTableTool := mcp.NewTool(
 		"alter_table",
-		mcp.WithDescription("Alter an existing table in the MySQL server. Make sure you have updated comments for each modified column. DO NOT drop table or existing columns!"),
+		mcp.WithDescription("Alter an existing table in the MySQL server. Make sure you have updated comments for each modified column. "+
+			"Dropping, renaming or modifying existing columns, indexes and the table is rejected unless the server allows it"),
 		mcp.WithString("query",
 			mcp.Required(),
 			mcp.Description("The SQL query to alter the table"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
-		),
+		dsnParam,
+		connectionParam,
 	)
 
 	descTableTool := mcp.NewTool(
@@ -89,11 +157,30 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		mcp.WithDescription("Describe the structure of a table"),
 		mcp.WithString("name",
 			mcp.Required(),
-			mcp.Description("The name of the table to describe"),
+			mcp.Description("The name of the table to describe, optionally qualified as database.table. Quote names with other characters than letters, digits, $ and _ in backticks"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
+		mcp.WithString("database",
+			mcp.Description("Database of the table. Defaults to the database of the connection"),
 		),
+		dsnParam,
+		connectionParam,
+		mcp.WithOutputSchema[TableDefinition](),
+	)
+
+	describeTableTool := mcp.NewTool(
+		"describe_table",
+		mcp.WithDescription("Describe a table as structured data: its columns with type, nullability, default, comment and generated expression, "+
+			"its indexes with their columns, uniqueness and cardinality, the foreign keys from and to it, and its check constraints"),
+		mcp.WithString("name",
+			mcp.Required(),
+			mcp.Description("The name of the table to describe, optionally qualified as database.table. Quote names with other characters than letters, digits, $ and _ in backticks"),
+		),
+		mcp.WithString("database",
+			mcp.Description("Database of the table. Defaults to the database of the connection"),
+		),
+		dsnParam,
+		connectionParam,
+		mcp.WithOutputSchema[TableDescription](),
 	)
 
 	// Data Tools
@@ -104,9 +191,29 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 			mcp.Required(),
 			mcp.Description("The SQL query to execute"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
+		mcp.WithNumber("max_rows",
+			mcp.Description(fmt.Sprintf("Maximum number of rows to return. Defaults to and cannot exceed the server limit (%d, 0 means unlimited)", cfg.Query.MaxRows)),
 		),
+		formatParam,
+		paramsParam,
+		transactionParam,
+		dsnParam,
+		connectionParam,
+		mcp.WithOutputSchema[StructuredResult](),
+	)
+
+	fetchMoreTool := mcp.NewTool(
+		"fetch_more",
+		mcp.WithDescription("Fetch the next rows of a truncated `read_query` result using the cursor it returned"),
+		mcp.WithString("cursor",
+			mcp.Required(),
+			mcp.Description("The cursor token returned by `read_query` or a previous `fetch_more` call"),
+		),
+		mcp.WithNumber("max_rows",
+			mcp.Description(fmt.Sprintf("Maximum number of rows to return. Defaults to and cannot exceed the server limit (%d, 0 means unlimited)", cfg.Query.MaxRows)),
+		),
+		formatParam,
+		mcp.WithOutputSchema[StructuredResult](),
 	)
 
 	writeQueryTool := mcp.NewTool(
@@ -116,9 +223,11 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 			mcp.Required(),
 			mcp.Description("The SQL query to execute"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
-		),
+		paramsParam,
+		dryRunParam,
+		transactionParam,
+		dsnParam,
+		connectionParam,
 	)
 
 	updateQueryTool := mcp.NewTool(
@@ -128,9 +237,12 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 			mcp.Required(),
 			mcp.Description("The SQL query to execute"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
-		),
+		paramsParam,
+		dryRunParam,
+		maxAffectedRowsParam,
+		transactionParam,
+		dsnParam,
+		connectionParam,
 	)
 
 	deleteQueryTool := mcp.NewTool(
@@ -140,38 +252,94 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 			mcp.Required(),
 			mcp.Description("The SQL query to execute"),
 		),
-		mcp.WithString("dsn",
-			mcp.Description("MySQL DSN (Data Source Name) string. If provided, this overrides the configuration."),
+		paramsParam,
+		dryRunParam,
+		maxAffectedRowsParam,
+		transactionParam,
+		dsnParam,
+		connectionParam,
+	)
+
+	// Transaction Tools
+	beginTransactionTool := mcp.NewTool(
+		"begin_transaction",
+		mcp.WithDescription("Start a transaction on a dedicated connection. Pass the returned transaction_id to `read_query`, `write_query`, `update_query` and `delete_query`, then call `commit` or `rollback`. Idle transactions are rolled back automatically"),
+		dsnParam,
+		connectionParam,
+	)
+
+	commitTool := mcp.NewTool(
+		"commit",
+		mcp.WithDescription("Commit a transaction started with `begin_transaction`"),
+		mcp.WithString("transaction_id",
+			mcp.Required(),
+			mcp.Description("The transaction_id returned by `begin_transaction`"),
+		),
+	)
+
+	rollbackTool := mcp.NewTool(
+		"rollback",
+		mcp.WithDescription("Roll back a transaction started with `begin_transaction`, discarding all of its changes"),
+		mcp.WithString("transaction_id",
+			mcp.Required(),
+			mcp.Description("The transaction_id returned by `begin_transaction`"),
 		),
 	)
 
 	// Register handlers for each tool
 	mcpServer.AddTool(listDatabaseTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		dsn := request.GetString("dsn", "")
-		result, err := HandleQuery(cfg, "SHOW DATABASES", StatementTypeNoExplainCheck, dsn)
+		conn, err := resolveConnection(registry, request)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		return mcp.NewToolResultText(result), nil
+		defer conn.Close()
+		opts := NewQueryOptions(cfg, request)
+		opts.Values = values
+		result, err := DoQuery(ctx, conn, "SHOW DATABASES", StatementTypeNoExplainCheck, nil, opts)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		conn.Access.FilterDatabases(result)
+		return QueryToolResult(result, opts), nil
 	})
 
 	mcpServer.AddTool(listTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		dsn := request.GetString("dsn", "")
-		result, err := HandleQuery(cfg, "SHOW TABLES", StatementTypeNoExplainCheck, dsn)
+		conn, err := resolveConnection(registry, request)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		return mcp.NewToolResultText(result), nil
+		defer conn.Close()
+		opts := NewQueryOptions(cfg, request)
+		opts.Values = values
+		filter := TableFilter{
+			Database: request.GetString("database", ""),
+			Pattern:  request.GetString("pattern", ""),
+			Regex:    request.GetBool("regex", false),
+			Type:     request.GetString("type", ""),
+		}
+		result, err := HandleListTables(ctx, conn, filter, opts)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return QueryToolResult(result, opts), nil
 	})
 
-	if !cfg.MySQL.ReadOnly {
+	if !readOnly {
 		mcpServer.AddTool(createTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			query, err := request.RequireString("query")
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			dsn := request.GetString("dsn", "")
-			result, err := HandleExec(cfg, query, StatementTypeNoExplainCheck, dsn)
+			conn, err := resolveWritableConnection(registry, request)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			defer conn.Close()
+			opts := NewWriteOptions(cfg, request)
+			if err := approver.Approve(ctx, conn, nil, query, StatementTypeCreateTable, nil, opts); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := HandleExec(ctx, conn, query, StatementTypeCreateTable, nil, opts)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -179,14 +347,22 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		})
 	}
 
-	if !cfg.MySQL.ReadOnly {
+	if !readOnly {
 		mcpServer.AddTool(alterTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 			query, err := request.RequireString("query")
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			dsn := request.GetString("dsn", "")
-			result, err := HandleExec(cfg, query, StatementTypeNoExplainCheck, dsn)
+			conn, err := resolveWritableConnection(registry, request)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			defer conn.Close()
+			opts := NewWriteOptions(cfg, request)
+			if err := approver.Approve(ctx, conn, nil, query, StatementTypeAlterTable, nil, opts); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			result, err := HandleExec(ctx, conn, query, StatementTypeAlterTable, nil, opts)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -199,35 +375,76 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		dsn := request.GetString("dsn", "")
-		result, err := HandleDescTable(cfg, name, dsn)
+		conn, err := resolveConnection(registry, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer conn.Close()
+		result, err := HandleDescTable(ctx, conn, name, request.GetString("database", ""))
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		return mcp.NewToolResultText(result), nil
+		return mcp.NewToolResultStructured(*result, result.CreateTable), nil
+	})
+
+	mcpServer.AddTool(describeTableTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, err := request.RequireString("name")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		conn, err := resolveConnection(registry, request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		defer conn.Close()
+		result, err := HandleDescribeTable(ctx, conn, name, request.GetString("database", ""))
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return mcp.NewToolResultStructuredOnly(*result), nil
 	})
 
 	mcpServer.AddTool(readQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		query, err := request.RequireString("query")
+		query, args, err := resolveQuery(request)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		opts := NewQueryOptions(cfg, request)
+		opts.Values = values
+		opts.Cursors = cursors
+		opts.CursorOwner = sessionID(ctx)
+		result, err := runQuery(ctx, registry, request, query, StatementTypeSelect, args, opts)
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		return QueryToolResult(result, opts), nil
+	})
+
+	mcpServer.AddTool(fetchMoreTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		token, err := request.RequireString("cursor")
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		dsn := request.GetString("dsn", "")
-		result, err := HandleQuery(cfg, query, StatementTypeSelect, dsn)
+		opts := NewQueryOptions(cfg, request)
+		opts.Cursors = cursors
+		opts.CursorOwner = sessionID(ctx)
+		result, err := cursors.Fetch(token, opts.CursorOwner, opts.MaxRows)
 		if err != nil {
 			return mcp.NewToolResultError(err.Error()), nil
 		}
-		return mcp.NewToolResultText(result), nil
+		return QueryToolResult(result, opts), nil
 	})
 
-	if !cfg.MySQL.ReadOnly {
+	if !readOnly {
 		mcpServer.AddTool(writeQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			query, err := request.RequireString("query")
+			query, args, err := resolveQuery(request)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			dsn := request.GetString("dsn", "")
-			result, err := HandleExec(cfg, query, StatementTypeInsert, dsn)
+			opts := NewWriteOptions(cfg, request)
+			opts.Query.Values = values
+			opts.Approver = approver
+			result, err := runExec(ctx, registry, request, query, StatementTypeInsert, args, opts)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -235,14 +452,16 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		})
 	}
 
-	if !cfg.MySQL.ReadOnly {
+	if !readOnly {
 		mcpServer.AddTool(updateQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			query, err := request.RequireString("query")
+			query, args, err := resolveQuery(request)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			dsn := request.GetString("dsn", "")
-			result, err := HandleExec(cfg, query, StatementTypeUpdate, dsn)
+			opts := NewWriteOptions(cfg, request)
+			opts.Query.Values = values
+			opts.Approver = approver
+			result, err := runExec(ctx, registry, request, query, StatementTypeUpdate, args, opts)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -250,14 +469,16 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		})
 	}
 
-	if !cfg.MySQL.ReadOnly {
+	if !readOnly {
 		mcpServer.AddTool(deleteQueryTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-			query, err := request.RequireString("query")
+			query, args, err := resolveQuery(request)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
-			dsn := request.GetString("dsn", "")
-			result, err := HandleExec(cfg, query, StatementTypeDelete, dsn)
+			opts := NewWriteOptions(cfg, request)
+			opts.Query.Values = values
+			opts.Approver = approver
+			result, err := runExec(ctx, registry, request, query, StatementTypeDelete, args, opts)
 			if err != nil {
 				return mcp.NewToolResultError(err.Error()), nil
 			}
@@ -265,91 +486,307 @@ func RegisterAllTools(mcpServer *server.MCPServer, cfg *config.Config) error {
 		})
 	}
 
+	if !readOnly {
+		mcpServer.AddTool(beginTransactionTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			conn, err := resolveWritableConnection(registry, request)
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			// The transaction closes the connection when it ends
+			t, err := registry.Transactions().Begin(ctx, conn, sessionID(ctx))
+			if err != nil {
+				conn.Close()
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("transaction_id: %s\nStarted a transaction on connection %q. It is rolled back after %s without a statement.",
+				t.ID, conn.Name, cfg.Transaction.IdleTimeout)), nil
+		})
+	}
+
+	if !readOnly {
+		mcpServer.AddTool(commitTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := request.RequireString("transaction_id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := registry.Transactions().Commit(id, sessionID(ctx)); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("transaction %s committed", id)), nil
+		})
+	}
+
+	if !readOnly {
+		mcpServer.AddTool(rollbackTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			id, err := request.RequireString("transaction_id")
+			if err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			if err := registry.Transactions().Rollback(id, sessionID(ctx)); err != nil {
+				return mcp.NewToolResultError(err.Error()), nil
+			}
+			return mcp.NewToolResultText(fmt.Sprintf("transaction %s rolled back", id)), nil
+		})
+	}
+
 	return nil
 }
 
-// HandleQuery executes a read query and returns the result as CSV
-func HandleQuery(cfg *config.Config, query, expect string, toolDSN string) (string, error) {
-	result, headers, err := DoQuery(cfg, query, expect, toolDSN)
+// resolveQuery reads the `query` tool parameter and binds the optional `params` to it
+func resolveQuery(request mcp.CallToolRequest) (string, []interface{}, error) {
+	query, err := request.RequireString("query")
 	if err != nil {
-		return "", err
+		return "", nil, err
 	}
+	return BindParams(query, request.GetArguments()["params"])
+}
 
-	s, err := MapToCSV(result, headers)
+// resolveConnection picks the connection named by the `connection` and `dsn` tool parameters.
+// The caller must close it when the call is done
+func resolveConnection(registry *Registry, request mcp.CallToolRequest) (*Connection, error) {
+	return registry.Get(request.GetString("connection", ""), request.GetString("dsn", ""))
+}
+
+// resolveWritableConnection is resolveConnection for tools that modify data or schema
+func resolveWritableConnection(registry *Registry, request mcp.CallToolRequest) (*Connection, error) {
+	conn, err := resolveConnection(registry, request)
+	if err != nil {
+		return nil, err
+	}
+	if conn.Config.ReadOnly {
+		conn.Close()
+		return nil, fmt.Errorf("connection %q is read-only", conn.Name)
+	}
+	return conn, nil
+}
+
+// resolveTransaction returns the transaction named by the `transaction_id` tool parameter, or nil if there is none
+func resolveTransaction(ctx context.Context, registry *Registry, request mcp.CallToolRequest) (*Transaction, error) {
+	id := request.GetString("transaction_id", "")
+	if id == "" {
+		return nil, nil
+	}
+	t, err := registry.Transactions().Get(id, sessionID(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	// The statement must run where the transaction is, so a different target is a mistake
+	if name := request.GetString("connection", ""); (name != "" && name != t.Connection.Name) || request.GetString("dsn", "") != "" {
+		return nil, fmt.Errorf("transaction %s runs on connection %q, omit the connection and dsn parameters", t.ID, t.Connection.Name)
+	}
+	return t, nil
+}
+
+// runQuery runs a read in the requested transaction, or on a pooled connection if there is none
+func runQuery(ctx context.Context, registry *Registry, request mcp.CallToolRequest, query, expect string, args []interface{}, opts QueryOptions) (*QueryResult, error) {
+	t, err := resolveTransaction(ctx, registry, request)
+	if err != nil {
+		return nil, err
+	}
+	if t != nil {
+		return t.Query(ctx, query, expect, args, opts)
+	}
+
+	conn, err := resolveConnection(registry, request)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return DoQuery(ctx, conn, query, expect, args, opts)
+}
+
+// runExec runs a write in the requested transaction, or in autocommit mode if there is none.
+// A dry run is undone in either case, so only real writes wait for approval
+func runExec(ctx context.Context, registry *Registry, request mcp.CallToolRequest, query, expect string, args []interface{}, opts WriteOptions) (string, error) {
+	t, err := resolveTransaction(ctx, registry, request)
 	if err != nil {
 		return "", err
 	}
+	if t != nil {
+		if opts.DryRun {
+			return t.DryRun(ctx, query, expect, args, opts)
+		}
+		if err := opts.Approver.Approve(ctx, t.Connection, t, query, expect, args, opts); err != nil {
+			return "", err
+		}
+		return t.Exec(ctx, query, expect, args, opts)
+	}
 
-	return s, nil
+	conn, err := resolveWritableConnection(registry, request)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	if opts.DryRun {
+		return HandleDryRun(ctx, conn, query, expect, args, opts)
+	}
+	if err := opts.Approver.Approve(ctx, conn, nil, query, expect, args, opts); err != nil {
+		return "", err
+	}
+	return HandleExec(ctx, conn, query, expect, args, opts)
 }
 
-// DoQuery executes a query and returns the result rows and headers
-func DoQuery(cfg *config.Config, query, expect string, toolDSN string) ([]map[string]interface{}, []string, error) {
-	db, err := GetDB(cfg, toolDSN)
+// HandleQuery executes a read query and returns the result as CSV
+func HandleQuery(ctx context.Context, conn *Connection, query, expect string, opts QueryOptions) (string, error) {
+	result, err := DoQuery(ctx, conn, query, expect, nil, opts)
 	if err != nil {
-		return nil, nil, err
+		return "", err
 	}
 
-	if len(expect) > 0 && cfg.MySQL.ExplainCheck {
-		if err := HandleExplain(cfg, query, expect, toolDSN); err != nil {
-			return nil, nil, err
+	return RenderResult(result, opts)
+}
+
+// DoQuery executes a query and returns the result rows and headers, scanning at most opts.MaxRows rows.
+// The statement is killed when ctx is done or the statement timeout expires before the rows are read
+// args are bound to the ? markers of the query
+func DoQuery(ctx context.Context, conn *Connection, query, expect string, args []interface{}, opts QueryOptions) (*QueryResult, error) {
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
+
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, conn, query, expect, args); err != nil {
+			return nil, err
 		}
 	}
 
-	rows, err := db.Queryx(query)
+	// Reads run in a read-only transaction that is always rolled back,
+	// so nothing the statement does can persist. It is not bound to ctx,
+	// a canceled statement is stopped with KILL QUERY through the session
+	tx, err := conn.ReadDB.BeginTxx(context.WithoutCancel(ctx), &sql.TxOptions{ReadOnly: true})
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer tx.Rollback()
 
-	cols, err := rows.Columns()
+	session, err := NewQuerySession(ctx, tx, conn.DB)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	defer session.Close()
 
-	result := []map[string]interface{}{}
-	for rows.Next() {
-		row, err := rows.SliceScan()
+	restore, err := limitExecutionTime(ctx, tx)
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	stop := session.Watch(ctx)
+	defer stop()
+
+	start := time.Now()
+	rows, err := tx.QueryxContext(session.ctx, query, args...)
+	if err != nil {
+		return nil, statementError(ctx, err)
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, opts.valueConverter())
+	if err != nil {
+		return nil, err
+	}
+	scanner.applyMasking(conn.Masker, query)
+
+	result := &QueryResult{Columns: scanner.columns, MaxRows: opts.MaxRows, Warnings: warnings, connection: conn.Name}
+	next, err := scanner.scan(rows, opts.MaxRows, result)
+	if err != nil {
+		return nil, statementError(ctx, err)
+	}
+
+	// The rest of a truncated result is read now and kept for fetch_more, within the same statement timeout
+	if result.Truncated && opts.Cursors != nil {
+		token, err := opts.Cursors.Open(opts.CursorOwner, conn.Name, rows, scanner, next)
 		if err != nil {
-			return nil, nil, err
+			zap.S().Warnw("returning truncated result without cursor", "error", statementError(ctx, err))
 		}
+		result.Cursor = token
+	}
+	result.Elapsed = time.Since(start)
 
-		resultRow := map[string]interface{}{}
-		for i, col := range cols {
-			switch v := row[i].(type) {
-			case []byte:
-				resultRow[col] = string(v)
-			default:
-				resultRow[col] = v
-			}
+	return result, nil
+}
+
+// HandleExec executes a write query with args bound to its ? markers and returns the result summary.
+// With an expected statement type the write must also pass the policy of opts
+func HandleExec(ctx context.Context, conn *Connection, query, expect string, args []interface{}, opts WriteOptions) (string, error) {
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
+
+	var stmt *Statement
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, conn, query, expect, args); err != nil {
+			return "", err
+		}
+		if stmt, err = checkWrite(query, opts); err != nil {
+			return "", err
 		}
-		result = append(result, resultRow)
 	}
 
-	return result, cols, nil
-}
+	// Pin one connection so the statement can be killed by its connection id
+	db, err := conn.DB.Connx(ctx)
+	if err != nil {
+		return "", err
+	}
+	defer db.Close()
 
-// HandleExec executes a write query and returns the result summary
-func HandleExec(cfg *config.Config, query, expect string, toolDSN string) (string, error) {
-	db, err := GetDB(cfg, toolDSN)
+	session, err := NewQuerySession(ctx, db, conn.DB)
 	if err != nil {
 		return "", err
 	}
+	defer session.Close()
 
-	if len(expect) > 0 && cfg.MySQL.ExplainCheck {
-		if err := HandleExplain(cfg, query, expect, toolDSN); err != nil {
-			return "", err
+	stop := session.Watch(ctx)
+	defer stop()
+
+	limit := opts.affectedRowsLimit(stmt)
+	if limit == 0 {
+		result, err := db.ExecContext(session.ctx, query, args...)
+		if err != nil {
+			return "", statementError(ctx, err)
 		}
+		summary, err := execSummary(ctx, result, expect)
+		return withWarnings(summary, warnings), err
+	}
+
+	if err := checkMatchedRows(session.ctx, db, stmt, args, limit); err != nil {
+		return "", statementError(ctx, err)
 	}
 
-	result, err := db.Exec(query)
+	// The count is an estimate, so the statement runs in a transaction that is rolled back
+	// if it changes more rows than allowed after all
+	tx, err := db.BeginTxx(context.WithoutCancel(ctx), nil)
 	if err != nil {
 		return "", err
 	}
+	defer tx.Rollback()
 
+	result, err := tx.ExecContext(session.ctx, query, args...)
+	if err != nil {
+		return "", statementError(ctx, err)
+	}
+	if err := checkAffectedRows(stmt, result, limit); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	summary, err := execSummary(ctx, result, expect)
+	return withWarnings(summary, warnings), err
+}
+
+// execSummary reports the rows affected by a write and, for INSERT, the last insert id.
+// The row count is also noted for the audit log
+func execSummary(ctx context.Context, result sql.Result, expect string) (string, error) {
 	ra, err := result.RowsAffected()
 	if err != nil {
 		return "", err
 	}
+	recordRowsAffected(ctx, ra)
 
 	switch expect {
 	case StatementTypeInsert:
@@ -363,119 +800,96 @@ func HandleExec(cfg *config.Config, query, expect string, toolDSN string) (strin
 	}
 }
 
-// HandleExplain checks query plan with EXPLAIN query
-func HandleExplain(cfg *config.Config, query, expect string, toolDSN string) error {
-	if !cfg.MySQL.ExplainCheck {
-		return nil
+// CheckQuery verifies the statement kind with the SQL parser and, if enabled, judges its query plan.
+// It returns the warnings of a plan over a limit when the explain action is warn
+func CheckQuery(ctx context.Context, conn *Connection, query, expect string, args []interface{}) ([]string, error) {
+	stmt, err := CheckStatement(query, expect)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Access.Check(stmt, conn.Database); err != nil {
+		return nil, err
 	}
 
-	db, err := GetDB(cfg, toolDSN)
-	if err != nil {
-		return err
+	switch stmt.Kind {
+	case StatementTypeSelect, StatementTypeInsert, StatementTypeUpdate, StatementTypeDelete:
+		return HandleExplain(ctx, conn, query, args)
+	default:
+		// SHOW, EXPLAIN and DDL statements have no query plan
+		return nil, nil
+	}
+}
+
+// HandleExplain checks that MySQL can build a query plan with EXPLAIN query and,
+// with explain limits configured, judges the plan against them
+func HandleExplain(ctx context.Context, conn *Connection, query string, args []interface{}) ([]string, error) {
+	if !conn.Config.ExplainCheck {
+		return nil, nil
+	}
+	if conn.PlanGuard != nil {
+		return conn.PlanGuard.Check(ctx, conn.DB, query, args)
 	}
 
-	rows, err := db.Queryx(fmt.Sprintf("EXPLAIN %s", query))
+	rows, err := conn.DB.QueryxContext(ctx, fmt.Sprintf("EXPLAIN %s", query), args...)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
 	result := []ExplainResult{}
 	for rows.Next() {
 		var row ExplainResult
 		if err := rows.StructScan(&row); err != nil {
-			return err
+			return nil, err
 		}
 		result = append(result, row)
 	}
 
-	if len(result) != 1 {
-		return fmt.Errorf("unable to check query plan, denied")
+	if len(result) == 0 {
+		return nil, fmt.Errorf("unable to check query plan, denied")
 	}
 
-	match := false
-	switch expect {
-	case StatementTypeInsert:
-		fallthrough
-	case StatementTypeUpdate:
-		fallthrough
-	case StatementTypeDelete:
-		if *result[0].SelectType == expect {
-			match = true
-		}
-	default:
-		// for SELECT type query, the select_type will be multiple values
-		// here we check if it's not INSERT, UPDATE or DELETE
-		match = true
-		for _, typ := range []string{StatementTypeInsert, StatementTypeUpdate, StatementTypeDelete} {
-			if *result[0].SelectType == typ {
-				match = false
-				break
-			}
-		}
-	}
+	return nil, nil
+}
 
-	if !match {
-		return fmt.Errorf("query plan does not match expected pattern, denied")
+// withWarnings appends warnings to the text output of a tool, one line each
+func withWarnings(s string, warnings []string) string {
+	if len(warnings) == 0 {
+		return s
 	}
-
-	return nil
+	if !strings.HasSuffix(s, "\n") {
+		s += "\n"
+	}
+	for _, warning := range warnings {
+		s += fmt.Sprintf("[warning: %s]\n", warning)
+	}
+	return s
 }
 
-// HandleDescTable describes a table structure
-func HandleDescTable(cfg *config.Config, name string, toolDSN string) (string, error) {
-	db, err := GetDB(cfg, toolDSN)
-	if err != nil {
-		return "", err
-	}
+// HandleDescTable describes a table structure. name may be qualified with its database,
+// otherwise it refers to database or the connection's default database
+func HandleDescTable(ctx context.Context, conn *Connection, name, database string) (*TableDefinition, error) {
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
 
-	rows, err := db.Queryx(fmt.Sprintf("SHOW CREATE TABLE %s", name))
+	table, err := ResolveTable(ctx, conn, name, database)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-
-	result := []ShowCreateTableResult{}
-	for rows.Next() {
-		var row ShowCreateTableResult
-		if err := rows.StructScan(&row); err != nil {
-			return "", err
-		}
-		result = append(result, row)
+	// SHOW CREATE TABLE names every column, describe_table leaves out the hidden ones
+	if conn.Access.restrictsColumns(table.Schema, table.Table) {
+		return nil, fmt.Errorf("access denied: table %s has columns that are not allowed, use describe_table", table)
 	}
 
-	if len(result) == 0 {
-		return "", fmt.Errorf("table %s does not exist", name)
+	var row ShowCreateTableResult
+	if err := conn.ReadDB.QueryRowxContext(ctx, "SHOW CREATE TABLE "+table.String()).StructScan(&row); err != nil {
+		return nil, statementError(ctx, err)
 	}
 
-	return result[0].CreateTable, nil
+	return &TableDefinition{Connection: conn.Name, Database: table.Schema, Table: table.Table, CreateTable: row.CreateTable}, nil
 }
 
 // MapToCSV converts map result to CSV format
 func MapToCSV(m []map[string]interface{}, headers []string) (string, error) {
-	var csvBuf strings.Builder
-	writer := csv.NewWriter(&csvBuf)
-
-	if err := writer.Write(headers); err != nil {
-		return "", fmt.Errorf("failed to write headers: %v", err)
-	}
-
-	for _, item := range m {
-		row := make([]string, len(headers))
-		for i, header := range headers {
-			value, exists := item[header]
-			if !exists {
-				return "", fmt.Errorf("key '%s' not found in map", header)
-			}
-			row[i] = fmt.Sprintf("%v", value)
-		}
-		if err := writer.Write(row); err != nil {
-			return "", fmt.Errorf("failed to write row: %v", err)
-		}
-	}
-
-	writer.Flush()
-	if err := writer.Error(); err != nil {
-		return "", fmt.Errorf("error flushing CSV writer: %v", err)
-	}
-
-	return csvBuf.String(), nil
+	return csvFormatter{nullValue: DefaultNullValue}.Format(headers, m)
 }
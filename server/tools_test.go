@@ -95,12 +95,12 @@ func TestRegisterAllTools(t *testing.T) {
 		// We can't actually test the server without mocking a lot,
 		// so we'll just ensure RegisterAllTools doesn't panic with nil
 		assert.Panics(t, func() {
-			_ = RegisterAllTools(nil, cfg)
+			_ = RegisterAllTools(nil, cfg, NewRegistry(cfg))
 		})
 	})
 }
 
 // Simple wrapper for HandleQuery for testing
-func mockHandleQuery(cfg *config.Config, query, expect string, toolDSN string) (string, error) {
+func mockHandleQuery(conn *Connection, query, expect string) (string, error) {
 	return "mocked result", nil
 }
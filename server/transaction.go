@@ -0,0 +1,389 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// Transaction is a transaction opened by begin_transaction on a dedicated connection.
+// Statements of the transaction run one at a time
+type Transaction struct {
+	ID         string
+	Connection *Connection
+	// owner is the MCP session that began the transaction
+	owner string
+	store *TransactionStore
+
+	mu sync.Mutex
+	// tx and session are nil once the transaction has ended
+	tx      *sqlx.Tx
+	session *QuerySession
+	timer   *time.Timer
+	// held counts the writes waiting for approval, which keep the transaction from expiring
+	held int
+	// lastUsed is when the last statement finished
+	lastUsed time.Time
+}
+
+// Query runs a read inside the transaction, so it sees the transaction's own changes.
+// The rows are read up to opts.MaxRows and the rest is discarded, since the connection
+// must be free for the next statement. Changes the query makes through stored functions
+// are undone, so only checked and approved writes are committed
+func (t *Transaction) Query(ctx context.Context, query, expect string, args []interface{}, opts QueryOptions) (*QueryResult, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx == nil {
+		return nil, fmt.Errorf("transaction %q has already ended", t.ID)
+	}
+
+	ctx, cancel := statementContext(ctx, t.Connection)
+	defer cancel()
+	t.use()
+	defer t.touch()
+
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, t.Connection, query, expect, args); err != nil {
+			return nil, err
+		}
+	}
+
+	restore, err := limitExecutionTime(ctx, t.tx)
+	if err != nil {
+		return nil, t.fail(ctx, err)
+	}
+	defer func() {
+		// A failed statement may have rolled the transaction back, which leaves nothing to restore
+		if t.tx != nil {
+			restore()
+		}
+	}()
+
+	stop := t.session.Watch(ctx)
+	defer stop()
+
+	if _, err := t.tx.ExecContext(t.session.ctx, "SAVEPOINT "+writeSavepoint); err != nil {
+		return nil, t.fail(ctx, err)
+	}
+	result, err := t.read(ctx, query, args, opts)
+	if t.tx == nil {
+		return nil, err
+	}
+	if rbErr := t.rollbackToSavepoint(ctx); rbErr != nil {
+		return nil, rbErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Warnings = warnings
+	return result, nil
+}
+
+// read runs a query and scans its rows, closing them before it returns. The caller must hold t.mu
+func (t *Transaction) read(ctx context.Context, query string, args []interface{}, opts QueryOptions) (*QueryResult, error) {
+	start := time.Now()
+	rows, err := t.tx.QueryxContext(t.session.ctx, query, args...)
+	if err != nil {
+		return nil, t.fail(ctx, err)
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, opts.valueConverter())
+	if err != nil {
+		return nil, err
+	}
+	scanner.applyMasking(t.Connection.Masker, query)
+
+	result := &QueryResult{Columns: scanner.columns, MaxRows: opts.MaxRows, connection: t.Connection.Name}
+	if _, err := scanner.scan(rows, opts.MaxRows, result); err != nil {
+		return nil, t.fail(ctx, err)
+	}
+	result.Elapsed = time.Since(start)
+
+	return result, nil
+}
+
+// Exec runs a write inside the transaction and returns the result summary. A write that changes
+// more rows than opts allows is undone by rolling back to a savepoint, keeping the earlier changes
+func (t *Transaction) Exec(ctx context.Context, query, expect string, args []interface{}, opts WriteOptions) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx == nil {
+		return "", fmt.Errorf("transaction %q has already ended", t.ID)
+	}
+
+	ctx, cancel := statementContext(ctx, t.Connection)
+	defer cancel()
+	t.use()
+	defer t.touch()
+
+	var stmt *Statement
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, t.Connection, query, expect, args); err != nil {
+			return "", err
+		}
+		if stmt, err = checkWrite(query, opts); err != nil {
+			return "", err
+		}
+	}
+
+	stop := t.session.Watch(ctx)
+	defer stop()
+
+	limit := opts.affectedRowsLimit(stmt)
+	if limit > 0 {
+		if err := checkMatchedRows(t.session.ctx, t.tx, stmt, args, limit); err != nil {
+			return "", t.fail(ctx, err)
+		}
+		if _, err := t.tx.ExecContext(t.session.ctx, "SAVEPOINT "+writeSavepoint); err != nil {
+			return "", t.fail(ctx, err)
+		}
+	}
+
+	result, err := t.tx.ExecContext(t.session.ctx, query, args...)
+	if err != nil {
+		return "", t.fail(ctx, err)
+	}
+
+	if limit > 0 {
+		if err := checkAffectedRows(stmt, result, limit); err != nil {
+			if rbErr := t.rollbackToSavepoint(ctx); rbErr != nil {
+				return "", rbErr
+			}
+			return "", err
+		}
+	}
+
+	summary, err := execSummary(ctx, result, expect)
+	return withWarnings(summary, warnings), err
+}
+
+// use stops the idle timer while a statement runs. The caller must hold t.mu
+func (t *Transaction) use() {
+	t.timer.Stop()
+}
+
+// touch restarts the idle timer after a statement. The caller must hold t.mu
+func (t *Transaction) touch() {
+	if t.tx == nil {
+		return
+	}
+	t.lastUsed = time.Now()
+	if t.held == 0 {
+		t.timer.Reset(t.store.idleTimeout)
+	}
+}
+
+// hold stops the idle timer while a write waits for the user's approval, which may take longer than
+// the idle timeout. The returned function restarts the timer once the last waiting write is answered
+func (t *Transaction) hold() func() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.held++
+	t.timer.Stop()
+
+	return func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.held--
+		t.touch()
+	}
+}
+
+// expire rolls back the transaction when the idle timer fires, unless a write is waiting for approval.
+// A timer that fired while a statement ran finds the transaction used since, and leaves it open
+func (t *Transaction) expire() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.held > 0 || time.Since(t.lastUsed) < t.store.idleTimeout {
+		return
+	}
+
+	zap.S().Infow("rolling back idle transaction", "transaction", t.ID, "connection", t.Connection.Name)
+	t.store.remove(t.ID)
+	t.end(false)
+}
+
+// fail handles a failed statement. A statement that was killed because ctx ended leaves the
+// connection unusable, so the transaction is rolled back. The caller must hold t.mu
+func (t *Transaction) fail(ctx context.Context, err error) error {
+	if ctx.Err() == nil {
+		return err
+	}
+	t.end(false)
+	t.store.remove(t.ID)
+	return fmt.Errorf("%v, transaction %s was rolled back", statementError(ctx, err), t.ID)
+}
+
+// end commits or rolls back the transaction and releases its connection, closing the pools
+// of a tool DSN. The caller must hold t.mu
+func (t *Transaction) end(commit bool) error {
+	if t.tx == nil {
+		return fmt.Errorf("transaction %q has already ended", t.ID)
+	}
+
+	var err error
+	if commit {
+		err = t.tx.Commit()
+	} else {
+		err = t.tx.Rollback()
+	}
+	t.session.Close()
+	t.tx = nil
+	t.session = nil
+	t.timer.Stop()
+	t.Connection.Close()
+	return err
+}
+
+// TransactionStore keeps the transactions opened by begin_transaction
+type TransactionStore struct {
+	idleTimeout time.Duration
+	maxOpen     int
+
+	mu  sync.Mutex
+	txs map[string]*Transaction
+}
+
+// NewTransactionStore - Create a transaction store. Transactions idle longer than idleTimeout are rolled back
+func NewTransactionStore(idleTimeout time.Duration, maxOpen int) *TransactionStore {
+	return &TransactionStore{
+		idleTimeout: idleTimeout,
+		maxOpen:     maxOpen,
+		txs:         map[string]*Transaction{},
+	}
+}
+
+// Begin starts a transaction on a dedicated connection of conn, owned by the MCP session owner
+func (s *TransactionStore) Begin(ctx context.Context, conn *Connection, owner string) (*Transaction, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("failed to generate transaction id: %v", err)
+	}
+
+	// The transaction outlives the begin_transaction call, so it is not bound to ctx
+	tx, err := conn.DB.BeginTxx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return nil, err
+	}
+	session, err := NewQuerySession(ctx, tx, conn.DB)
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	t := &Transaction{
+		ID:         hex.EncodeToString(buf),
+		Connection: conn,
+		owner:      owner,
+		store:      s,
+		tx:         tx,
+		session:    session,
+		lastUsed:   time.Now(),
+	}
+	t.timer = time.AfterFunc(s.idleTimeout, t.expire)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.maxOpen > 0 && len(s.txs) >= s.maxOpen {
+		t.end(false)
+		return nil, fmt.Errorf("too many open transactions (max %d)", s.maxOpen)
+	}
+	s.txs[t.ID] = t
+	return t, nil
+}
+
+// Get returns an open transaction of the MCP session owner
+func (s *TransactionStore) Get(id, owner string) (*Transaction, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.txs[id]
+	// Transactions of other sessions are reported as missing, so their ids cannot be probed
+	if !ok || t.owner != owner {
+		return nil, fmt.Errorf("transaction %q does not exist or has expired", id)
+	}
+	return t, nil
+}
+
+// Commit commits a transaction of the MCP session owner
+func (s *TransactionStore) Commit(id, owner string) error {
+	return s.finish(id, owner, true)
+}
+
+// Rollback rolls back a transaction of the MCP session owner
+func (s *TransactionStore) Rollback(id, owner string) error {
+	return s.finish(id, owner, false)
+}
+
+// RollbackSession rolls back every transaction of an MCP session that ended
+func (s *TransactionStore) RollbackSession(owner string) {
+	for _, id := range s.ids(owner) {
+		zap.S().Infow("rolling back transaction of closed session", "transaction", id)
+		s.Rollback(id, owner)
+	}
+}
+
+// RollbackAll rolls back every open transaction
+func (s *TransactionStore) RollbackAll() {
+	s.mu.Lock()
+	txs := make([]*Transaction, 0, len(s.txs))
+	for _, t := range s.txs {
+		txs = append(txs, t)
+	}
+	s.mu.Unlock()
+
+	for _, t := range txs {
+		s.Rollback(t.ID, t.owner)
+	}
+}
+
+func (s *TransactionStore) finish(id, owner string, commit bool) error {
+	t, err := s.Get(id, owner)
+	if err != nil {
+		return err
+	}
+	s.remove(id)
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.end(commit)
+}
+
+func (s *TransactionStore) ids(owner string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := []string{}
+	for id, t := range s.txs {
+		if t.owner == owner {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func (s *TransactionStore) remove(id string) {
+	s.mu.Lock()
+	delete(s.txs, id)
+	s.mu.Unlock()
+}
+
+// sessionID returns the id of the MCP session of a tool call, or "" outside of a session
+func sessionID(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// addTestTransaction registers a transaction without a database connection
+func addTestTransaction(s *TransactionStore, id, owner string) *Transaction {
+	t := &Transaction{ID: id, Connection: &Connection{Name: "default"}, owner: owner, store: s}
+	t.timer = time.AfterFunc(time.Hour, func() {})
+	s.txs[id] = t
+	return t
+}
+
+func TestTransactionStore(t *testing.T) {
+	t.Run("transactions belong to their session", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		addTestTransaction(store, "tx1", "session-a")
+
+		tx, err := store.Get("tx1", "session-a")
+		assert.NoError(t, err)
+		assert.Equal(t, "tx1", tx.ID)
+
+		_, err = store.Get("tx1", "session-b")
+		assert.ErrorContains(t, err, "does not exist")
+		assert.Error(t, store.Rollback("tx1", "session-b"))
+	})
+
+	t.Run("unknown transaction", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		assert.ErrorContains(t, store.Commit("missing", ""), "does not exist")
+	})
+
+	t.Run("ended transactions are removed", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		addTestTransaction(store, "tx1", "")
+
+		// The test transaction has no connection, so ending it reports it as already ended
+		assert.Error(t, store.Rollback("tx1", ""))
+		_, err := store.Get("tx1", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("rollback of a closed session", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		addTestTransaction(store, "tx1", "session-a")
+		addTestTransaction(store, "tx2", "session-a")
+		addTestTransaction(store, "tx3", "session-b")
+
+		store.RollbackSession("session-a")
+		assert.Equal(t, []string{"tx3"}, store.ids("session-b"))
+		assert.Empty(t, store.ids("session-a"))
+	})
+
+	t.Run("statements on an ended transaction", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		tx := addTestTransaction(store, "tx1", "")
+
+		_, err := tx.Exec(context.Background(), "DELETE FROM t WHERE id = 1", StatementTypeDelete, nil, WriteOptions{})
+		assert.ErrorContains(t, err, "already ended")
+		_, err = tx.Query(context.Background(), "SELECT 1", StatementTypeSelect, nil, QueryOptions{})
+		assert.ErrorContains(t, err, "already ended")
+	})
+
+	t.Run("writes waiting for approval keep the transaction", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		tx := addTestTransaction(store, "tx1", "")
+
+		release := tx.hold()
+		second := tx.hold()
+		tx.expire()
+		release()
+		tx.expire()
+		_, err := store.Get("tx1", "")
+		assert.NoError(t, err)
+
+		second()
+		tx.expire()
+		_, err = store.Get("tx1", "")
+		assert.Error(t, err)
+	})
+
+	t.Run("a statement running when the timer fires keeps the transaction", func(t *testing.T) {
+		store := NewTransactionStore(time.Minute, 0)
+		tx := addTestTransaction(store, "tx1", "")
+
+		// The timer fired while the statement held the lock, and runs once the statement finished
+		tx.mu.Lock()
+		tx.use()
+		tx.lastUsed = time.Now()
+		tx.mu.Unlock()
+		tx.expire()
+		_, err := store.Get("tx1", "")
+		assert.NoError(t, err)
+
+		tx.lastUsed = time.Now().Add(-2 * time.Minute)
+		tx.expire()
+		_, err = store.Get("tx1", "")
+		assert.Error(t, err)
+	})
+}
+
+func TestSessionID(t *testing.T) {
+	assert.Equal(t, "", sessionID(context.Background()))
+}
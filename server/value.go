@@ -0,0 +1,260 @@
+package server
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	BinaryEncodingHex    = "hex"
+	BinaryEncodingBase64 = "base64"
+
+	// TimeZoneLocal keeps the time zone of the MCP server process and the MySQL session
+	TimeZoneLocal = "Local"
+
+	// DefaultNullValue is how NULL is written in text formats unless configured otherwise
+	DefaultNullValue = "NULL"
+)
+
+const (
+	isoDate      = "2006-01-02"
+	isoDateTime  = "2006-01-02T15:04:05.999999"
+	isoTimestamp = "2006-01-02T15:04:05.999999Z07:00"
+	// mysqlDateTime is how DATETIME and TIMESTAMP values arrive without parseTime
+	mysqlDateTime = "2006-01-02 15:04:05.999999"
+)
+
+// ValueConverter turns the values scanned from the driver into typed values based on the MySQL column type
+type ValueConverter struct {
+	// BinaryEncoding is hex or base64
+	BinaryEncoding string
+	// Location is the time zone TIMESTAMP values are rendered in. nil renders them without an offset,
+	// as the wall clock time of the session time zone, which the server does not know
+	Location *time.Location
+}
+
+// NewValueConverter - Create a value converter from the query configuration
+func NewValueConverter(cfg *config.Config) (*ValueConverter, error) {
+	encoding := strings.ToLower(cfg.Query.BinaryEncoding)
+	switch encoding {
+	case "":
+		encoding = BinaryEncodingHex
+	case BinaryEncodingHex, BinaryEncodingBase64:
+	default:
+		return nil, fmt.Errorf("unknown binary encoding %q, expected %s or %s", cfg.Query.BinaryEncoding, BinaryEncodingHex, BinaryEncodingBase64)
+	}
+
+	conv := &ValueConverter{BinaryEncoding: encoding}
+	if cfg.Query.TimeZone != TimeZoneLocal {
+		loc, err := LoadTimeZone(cfg.Query.TimeZone)
+		if err != nil {
+			return nil, err
+		}
+		conv.Location = loc
+	}
+	return conv, nil
+}
+
+// LoadTimeZone resolves a configured time zone name. An empty name is UTC
+func LoadTimeZone(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time zone %q: %v", name, err)
+	}
+	return loc, nil
+}
+
+// Convert converts a scanned value of a column with the given database type name, as reported
+// by sql.ColumnType.DatabaseTypeName. NULL stays nil, integers and floats become numbers,
+// DECIMAL becomes a json.Number so no precision is lost, binary data is encoded as text
+// and temporal values are formatted as ISO-8601
+func (c *ValueConverter) Convert(typeName string, v interface{}) (interface{}, error) {
+	if v == nil {
+		return nil, nil
+	}
+
+	switch typeName {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR":
+		if b, ok := v.([]byte); ok {
+			return strconv.ParseInt(string(b), 10, 64)
+		}
+	case "UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT", "UNSIGNED BIGINT":
+		if b, ok := v.([]byte); ok {
+			return strconv.ParseUint(string(b), 10, 64)
+		}
+	case "FLOAT", "DOUBLE":
+		if b, ok := v.([]byte); ok {
+			return strconv.ParseFloat(string(b), 64)
+		}
+	case "DECIMAL":
+		if b, ok := v.([]byte); ok {
+			return json.Number(b), nil
+		}
+	case "BINARY", "VARBINARY", "BLOB", "TINYBLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		if b, ok := v.([]byte); ok {
+			return c.encodeBinary(b), nil
+		}
+	case "DATE":
+		if t, ok := v.(time.Time); ok {
+			if t.IsZero() {
+				return "0000-00-00", nil
+			}
+			return t.Format(isoDate), nil
+		}
+	case "DATETIME":
+		// DATETIME has no time zone, so it is rendered as the stored wall clock time
+		switch t := v.(type) {
+		case time.Time:
+			if t.IsZero() {
+				return "0000-00-00 00:00:00", nil
+			}
+			return t.Format(isoDateTime), nil
+		case []byte:
+			return strings.Replace(string(t), " ", "T", 1), nil
+		}
+	case "TIMESTAMP":
+		if c.Location == nil {
+			return c.Convert("DATETIME", v)
+		}
+		// The session time zone is Location, so TIMESTAMP values are instants in Location
+		switch t := v.(type) {
+		case time.Time:
+			if t.IsZero() {
+				return "0000-00-00 00:00:00", nil
+			}
+			return t.In(c.Location).Format(isoTimestamp), nil
+		case []byte:
+			parsed, err := time.ParseInLocation(mysqlDateTime, string(t), c.Location)
+			if err != nil {
+				// Zero dates and other values Go cannot represent are kept as MySQL sent them
+				return string(t), nil
+			}
+			return parsed.Format(isoTimestamp), nil
+		}
+	}
+
+	if b, ok := v.([]byte); ok {
+		return string(b), nil
+	}
+	return v, nil
+}
+
+func (c *ValueConverter) encodeBinary(b []byte) string {
+	if c.BinaryEncoding == BinaryEncodingBase64 {
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	return "0x" + hex.EncodeToString(b)
+}
+
+// rowScanner reads the rows of one result set, converting each value by its column type
+type rowScanner struct {
+	columns []ColumnInfo
+	conv    *ValueConverter
+	// masks holds the masking mode of each column, or is nil when nothing is masked
+	masks  []string
+	masker *Masker
+}
+
+func newRowScanner(rows *sqlx.Rows, conv *ValueConverter) (*rowScanner, error) {
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+
+	columns := make([]ColumnInfo, len(columnTypes))
+	for i, ct := range columnTypes {
+		nullable, _ := ct.Nullable()
+		columns[i] = ColumnInfo{Name: ct.Name(), Type: ct.DatabaseTypeName(), Nullable: nullable}
+	}
+	return &rowScanner{columns: columns, conv: conv}, nil
+}
+
+// scan appends up to maxRows rows to result. When more rows are available it sets
+// result.Truncated and returns the first row that did not fit
+func (s *rowScanner) scan(rows *sqlx.Rows, maxRows int, result *QueryResult) (map[string]interface{}, error) {
+	if result.Rows == nil {
+		result.Rows = []map[string]interface{}{}
+	}
+
+	for rows.Next() {
+		row, err := rows.SliceScan()
+		if err != nil {
+			return nil, err
+		}
+
+		resultRow, err := s.convert(row)
+		if err != nil {
+			return nil, err
+		}
+
+		// Stop scanning once the limit is reached; the extra row tells us the result was cut off
+		if maxRows > 0 && len(result.Rows) >= maxRows {
+			result.Truncated = true
+			return resultRow, nil
+		}
+		result.Rows = append(result.Rows, resultRow)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return nil, nil
+}
+
+// convert turns the raw values of one row into a map keyed by column name
+func (s *rowScanner) convert(row []interface{}) (map[string]interface{}, error) {
+	resultRow := map[string]interface{}{}
+	for i, col := range s.columns {
+		value, err := s.conv.Convert(col.Type, row[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert column %s of type %s: %v", col.Name, col.Type, err)
+		}
+		if s.masks != nil && s.masks[i] != "" {
+			value = s.masker.Mask(s.masks[i], value)
+		}
+		resultRow[col.Name] = value
+	}
+	return resultRow, nil
+}
+
+// TimeZoneDSN makes the driver and the MySQL session use the configured time zone,
+// so TIMESTAMP values are returned and parsed in it. Local leaves the DSN unchanged,
+// and TIMESTAMP values are then rendered without an offset
+func TimeZoneDSN(dsn string, timeZone string) (string, error) {
+	if timeZone == TimeZoneLocal {
+		return dsn, nil
+	}
+
+	loc, err := LoadTimeZone(timeZone)
+	if err != nil {
+		return "", err
+	}
+
+	mysqlCfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse DSN: %v", err)
+	}
+	if mysqlCfg.Params == nil {
+		mysqlCfg.Params = map[string]string{}
+	}
+	mysqlCfg.Loc = loc
+	// A numeric offset works without the server's time zone tables
+	if loc == time.UTC {
+		mysqlCfg.Params["time_zone"] = "'+00:00'"
+	} else {
+		mysqlCfg.Params["time_zone"] = "'" + loc.String() + "'"
+	}
+	return mysqlCfg.FormatDSN(), nil
+}
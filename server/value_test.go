@@ -0,0 +1,129 @@
+package server
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValueConverter(t *testing.T) {
+	tokyo, err := time.LoadLocation("Asia/Tokyo")
+	assert.NoError(t, err)
+	conv := &ValueConverter{BinaryEncoding: BinaryEncodingHex, Location: tokyo}
+
+	tests := []struct {
+		name     string
+		typeName string
+		value    interface{}
+		want     interface{}
+	}{
+		{"NULL", "VARCHAR", nil, nil},
+		{"int", "INT", []byte("-42"), int64(-42)},
+		{"unsigned bigint", "UNSIGNED BIGINT", []byte("18446744073709551615"), uint64(18446744073709551615)},
+		{"binary protocol int", "BIGINT", int64(7), int64(7)},
+		{"double", "DOUBLE", []byte("1.5"), 1.5},
+		{"decimal keeps precision", "DECIMAL", []byte("12345678901234567890.123456789"), json.Number("12345678901234567890.123456789")},
+		{"varchar", "VARCHAR", []byte("hello"), "hello"},
+		{"blob as hex", "BLOB", []byte{0x00, 0xff, 0x10}, "0x00ff10"},
+		{"bit as hex", "BIT", []byte{0x01}, "0x01"},
+		{"date", "DATE", time.Date(2024, 2, 29, 0, 0, 0, 0, tokyo), "2024-02-29"},
+		{"zero date", "DATE", time.Time{}, "0000-00-00"},
+		{"datetime is wall clock", "DATETIME", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02T03:04:05"},
+		{"datetime fraction", "DATETIME", time.Date(2024, 1, 2, 3, 4, 5, 120000000, time.UTC), "2024-01-02T03:04:05.12"},
+		{"datetime text", "DATETIME", []byte("2024-01-02 03:04:05"), "2024-01-02T03:04:05"},
+		{"timestamp in location", "TIMESTAMP", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), "2024-01-02T12:04:05+09:00"},
+		{"timestamp text", "TIMESTAMP", []byte("2024-01-02 12:04:05"), "2024-01-02T12:04:05+09:00"},
+		{"zero timestamp text", "TIMESTAMP", []byte("0000-00-00 00:00:00"), "0000-00-00 00:00:00"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := conv.Convert(tt.typeName, tt.value)
+			assert.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+
+	t.Run("base64", func(t *testing.T) {
+		conv := &ValueConverter{BinaryEncoding: BinaryEncodingBase64, Location: time.UTC}
+		got, err := conv.Convert("VARBINARY", []byte("hi"))
+		assert.NoError(t, err)
+		assert.Equal(t, "aGk=", got)
+	})
+
+	t.Run("invalid integer", func(t *testing.T) {
+		_, err := conv.Convert("INT", []byte("abc"))
+		assert.Error(t, err)
+	})
+}
+
+func TestNewValueConverter(t *testing.T) {
+	t.Run("defaults", func(t *testing.T) {
+		conv, err := NewValueConverter(&config.Config{})
+		assert.NoError(t, err)
+		assert.Equal(t, BinaryEncodingHex, conv.BinaryEncoding)
+		assert.Equal(t, time.UTC, conv.Location)
+	})
+
+	t.Run("local time zone", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Query.TimeZone = TimeZoneLocal
+		conv, err := NewValueConverter(cfg)
+		assert.NoError(t, err)
+		assert.Nil(t, conv.Location)
+
+		// The session time zone is unknown, so TIMESTAMP values have no offset
+		v, err := conv.Convert("TIMESTAMP", time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC))
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-01-02T03:04:05", v)
+		v, err = conv.Convert("TIMESTAMP", []byte("2024-01-02 03:04:05"))
+		assert.NoError(t, err)
+		assert.Equal(t, "2024-01-02T03:04:05", v)
+	})
+
+	t.Run("unknown binary encoding", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Query.BinaryEncoding = "base32"
+		_, err := NewValueConverter(cfg)
+		assert.Error(t, err)
+	})
+
+	t.Run("unknown time zone", func(t *testing.T) {
+		cfg := &config.Config{}
+		cfg.Query.TimeZone = "Mars/Olympus"
+		_, err := NewValueConverter(cfg)
+		assert.Error(t, err)
+	})
+}
+
+func TestTimeZoneDSN(t *testing.T) {
+	dsn := "user:pass@tcp(localhost:3306)/db?parseTime=true&loc=Local"
+
+	t.Run("UTC", func(t *testing.T) {
+		got, err := TimeZoneDSN(dsn, "UTC")
+		assert.NoError(t, err)
+		mysqlCfg, err := mysql.ParseDSN(got)
+		assert.NoError(t, err)
+		assert.Equal(t, time.UTC, mysqlCfg.Loc)
+		assert.Equal(t, "'+00:00'", mysqlCfg.Params["time_zone"])
+	})
+
+	t.Run("named zone", func(t *testing.T) {
+		got, err := TimeZoneDSN(dsn, "Asia/Tokyo")
+		assert.NoError(t, err)
+		mysqlCfg, err := mysql.ParseDSN(got)
+		assert.NoError(t, err)
+		assert.Equal(t, "Asia/Tokyo", mysqlCfg.Loc.String())
+		assert.Equal(t, "'Asia/Tokyo'", mysqlCfg.Params["time_zone"])
+	})
+
+	t.Run("Local keeps the DSN", func(t *testing.T) {
+		got, err := TimeZoneDSN(dsn, TimeZoneLocal)
+		assert.NoError(t, err)
+		assert.Equal(t, dsn, got)
+	})
+}
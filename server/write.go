@@ -0,0 +1,691 @@
+package server
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/jmoiron/sqlx"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+	"github.com/pingcap/tidb/pkg/parser/test_driver"
+)
+
+// writeSavepoint is the savepoint a statement inside an open transaction rolls back to when it is undone
+const writeSavepoint = "mcp_write"
+
+// WriteOptions controls how the write tools run their statement
+type WriteOptions struct {
+	// DryRun runs the statement in a transaction that is always rolled back
+	DryRun bool
+	// SampleRows is how many matched rows a dry run shows before and after the statement. 0 shows none
+	SampleRows int
+	// RequireWhere rejects UPDATE and DELETE statements whose WHERE clause does not restrict the rows
+	RequireWhere bool
+	// MaxAffectedRows is the most rows an UPDATE or DELETE may change. 0 means unlimited
+	MaxAffectedRows int
+	// DDL decides which operations CREATE TABLE and ALTER TABLE may run
+	DDL DDLPolicy
+	// Query renders the sampled rows
+	Query QueryOptions
+	// Approver asks the user to confirm writes on connections that require approval
+	Approver *Approver
+}
+
+// NewWriteOptions - Build the options for a write from the configuration and the tool call arguments
+func NewWriteOptions(cfg *config.Config, request mcp.CallToolRequest) WriteOptions {
+	opts := WriteOptions{
+		DryRun:          request.GetBool("dry_run", cfg.Write.DryRun),
+		SampleRows:      cfg.Write.DryRunSampleRows,
+		RequireWhere:    cfg.Write.RequireWhere,
+		MaxAffectedRows: cfg.Write.MaxAffectedRows,
+		DDL:             NewDDLPolicy(cfg),
+		Query:           NewQueryOptions(cfg, request),
+	}
+
+	// A per-call max_affected_rows may lower the configured limit but never raise it
+	if maxAffected := request.GetInt("max_affected_rows", 0); maxAffected > 0 && (opts.MaxAffectedRows == 0 || maxAffected < opts.MaxAffectedRows) {
+		opts.MaxAffectedRows = maxAffected
+	}
+
+	return opts
+}
+
+// affectedRowsLimit returns the ceiling on the rows stmt may change, or 0 if it has none
+func (o WriteOptions) affectedRowsLimit(stmt *Statement) int64 {
+	if stmt == nil || o.MaxAffectedRows <= 0 {
+		return 0
+	}
+	switch stmt.Kind {
+	case StatementTypeUpdate, StatementTypeDelete:
+		return int64(o.MaxAffectedRows)
+	default:
+		return 0
+	}
+}
+
+// checkWrite parses a write and applies the statement policy of opts to it
+func checkWrite(query string, opts WriteOptions) (*Statement, error) {
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		return nil, err
+	}
+	if opts.RequireWhere {
+		if err := CheckWhere(stmt); err != nil {
+			return nil, err
+		}
+	}
+	if err := opts.DDL.Check(stmt); err != nil {
+		return nil, err
+	}
+	return stmt, nil
+}
+
+// checkMatchedRows counts the rows a single-table UPDATE or DELETE matches and refuses the statement
+// when they are more than limit. Counting stops after limit+1 rows. Statements that cannot be
+// counted pass, the affected rows are checked after they ran
+func checkMatchedRows(ctx context.Context, db sqlx.QueryerContext, stmt *Statement, args []interface{}, limit int64) error {
+	plan, err := newMatchPlan(stmt, args, int(limit)+1)
+	if err != nil || plan == nil {
+		return err
+	}
+
+	var count int64
+	if err := db.QueryRowxContext(ctx, matchCountQuery(plan), plan.args...).Scan(&count); err != nil {
+		return fmt.Errorf("failed to count the matched rows: %v", err)
+	}
+	if count > limit {
+		return fmt.Errorf("%s matches more than %d rows (max_affected_rows), refusing to run it. Narrow the WHERE clause or split the change into batches", stmt.Kind, limit)
+	}
+	return nil
+}
+
+// matchCountQuery counts the rows of a match plan, up to the plan's row limit
+func matchCountQuery(plan *matchPlan) string {
+	return fmt.Sprintf("SELECT COUNT(*) FROM (SELECT 1 FROM %s%s) AS matched", plan.from, plan.clauses)
+}
+
+// checkAffectedRows fails when a statement changed more than limit rows. The caller undoes the statement
+func checkAffectedRows(stmt *Statement, result sql.Result, limit int64) error {
+	ra, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if ra > limit {
+		return fmt.Errorf("%s changed %d rows, more than %d (max_affected_rows), and was rolled back", stmt.Kind, ra, limit)
+	}
+	return nil
+}
+
+// dbtx is a connection, transaction or pinned session statements can run on
+type dbtx interface {
+	sqlx.QueryerContext
+	sqlx.ExecerContext
+}
+
+// HandleDryRun runs a write in a transaction that is always rolled back and reports the rows it
+// affected, together with a sample of the rows it matches before and after the statement
+func HandleDryRun(ctx context.Context, conn *Connection, query, expect string, args []interface{}, opts WriteOptions) (string, error) {
+	ctx, cancel := statementContext(ctx, conn)
+	defer cancel()
+
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, conn, query, expect, args); err != nil {
+			return "", err
+		}
+		if _, err := checkWrite(query, opts); err != nil {
+			return "", err
+		}
+	}
+
+	// The deferred Rollback ends the transaction; a canceled ctx kills the statement through the session
+	tx, err := conn.DB.BeginTxx(context.WithoutCancel(ctx), nil)
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	session, err := NewQuerySession(ctx, tx, conn.DB)
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+
+	restore, err := limitExecutionTime(ctx, tx)
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	stop := session.Watch(ctx)
+	defer stop()
+
+	report, err := dryRun(session.ctx, tx, query, args, opts, conn)
+	if err != nil {
+		return "", statementError(ctx, err)
+	}
+	return withWarnings(report, warnings), nil
+}
+
+// dryRun runs the statement on db and reports what it changed. The caller undoes the changes
+func dryRun(ctx context.Context, db dbtx, query string, args []interface{}, opts WriteOptions, conn *Connection) (string, error) {
+	stmt, err := ParseStatement(query)
+	if err != nil {
+		return "", err
+	}
+	if err := checkTransactionalTables(ctx, db, dryRunTargets(stmt, conn.Database)); err != nil {
+		return "", err
+	}
+
+	var plan *matchPlan
+	if opts.SampleRows > 0 {
+		// One row more than shown tells whether the sample was cut off
+		if plan, err = newMatchPlan(stmt, args, opts.SampleRows+1); err != nil {
+			return "", err
+		}
+	}
+
+	report := &dryRunReport{}
+	if plan != nil {
+		// The samples select every column, so they are left out where access rules hide some
+		target := tableRef{db: plan.schema, table: plan.table}
+		if target.db == "" {
+			target.db = conn.Database
+		}
+		if conn.Access.restrictsColumns(target.db, target.table) {
+			report.note = fmt.Sprintf("No rows were sampled: access rules hide columns of %s", target)
+			plan = nil
+		}
+	}
+	var keys []string
+	var keyValues [][]interface{}
+	if plan != nil {
+		var raw [][]interface{}
+		report.before, raw, err = sampleRows(ctx, db, plan.query, plan.args, opts, conn)
+		if err != nil {
+			return "", fmt.Errorf("failed to sample the matched rows: %v", err)
+		}
+
+		// Updated rows may no longer match the WHERE clause, so they are looked up again by primary key
+		if stmt.Kind == StatementTypeUpdate {
+			if keys, err = primaryKey(ctx, db, plan.schema, plan.table); err != nil {
+				return "", err
+			}
+			keyValues = columnValues(report.before.Columns, raw, keys)
+		}
+	}
+
+	result, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return "", err
+	}
+	if report.summary, err = execSummary(ctx, result, stmt.Kind); err != nil {
+		return "", err
+	}
+	if limit := opts.affectedRowsLimit(stmt); limit > 0 {
+		if err := checkAffectedRows(stmt, result, limit); err != nil {
+			report.refused = fmt.Sprintf("Without dry_run the statement would be refused: it changes more than %d rows (max_affected_rows)", limit)
+		}
+	}
+
+	switch {
+	case plan == nil:
+		if report.note == "" && opts.SampleRows > 0 && (stmt.Kind == StatementTypeUpdate || stmt.Kind == StatementTypeDelete) {
+			report.note = "No rows were sampled: only single-table UPDATE and DELETE statements without WITH are sampled"
+		}
+	case len(keyValues) > 0:
+		afterQuery, afterArgs := keyQuery(plan.from, keys, keyValues)
+		if report.after, _, err = sampleRows(ctx, db, afterQuery, afterArgs, opts, conn); err != nil {
+			return "", fmt.Errorf("failed to sample the updated rows: %v", err)
+		}
+		report.sameRows = true
+	default:
+		if report.after, _, err = sampleRows(ctx, db, plan.query, plan.args, opts, conn); err != nil {
+			return "", fmt.Errorf("failed to sample the matched rows: %v", err)
+		}
+	}
+
+	return report.render(opts.Query)
+}
+
+// DryRun runs a write inside the transaction and undoes it by rolling back to a savepoint,
+// so the changes the transaction made before are kept
+func (t *Transaction) DryRun(ctx context.Context, query, expect string, args []interface{}, opts WriteOptions) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.tx == nil {
+		return "", fmt.Errorf("transaction %q has already ended", t.ID)
+	}
+
+	ctx, cancel := statementContext(ctx, t.Connection)
+	defer cancel()
+	t.use()
+	defer t.touch()
+
+	var warnings []string
+	if len(expect) > 0 {
+		var err error
+		if warnings, err = CheckQuery(ctx, t.Connection, query, expect, args); err != nil {
+			return "", err
+		}
+		if _, err := checkWrite(query, opts); err != nil {
+			return "", err
+		}
+	}
+
+	stop := t.session.Watch(ctx)
+	defer stop()
+
+	if _, err := t.tx.ExecContext(t.session.ctx, "SAVEPOINT "+writeSavepoint); err != nil {
+		return "", t.fail(ctx, err)
+	}
+
+	report, err := dryRun(t.session.ctx, t.tx, query, args, opts, t.Connection)
+	if err != nil && ctx.Err() != nil {
+		return "", t.fail(ctx, err)
+	}
+
+	if rbErr := t.rollbackToSavepoint(ctx); rbErr != nil {
+		return "", rbErr
+	}
+	if err != nil {
+		return "", err
+	}
+	return withWarnings(report, warnings), nil
+}
+
+// dryRunTargets returns the tables a write may change: the table of an INSERT or REPLACE and every table
+// joined by an UPDATE or DELETE. Tables only read in subqueries are left out
+func dryRunTargets(stmt *Statement, currentDB string) []tableRef {
+	refs := newTableRefCollector(currentDB)
+	stmt.Node.Accept(refs)
+
+	var from *ast.TableRefsClause
+	switch n := stmt.Node.(type) {
+	case *ast.InsertStmt:
+		from = n.Table
+	case *ast.UpdateStmt:
+		from = n.TableRefs
+	case *ast.DeleteStmt:
+		from = n.TableRefs
+	}
+	if from == nil {
+		return nil
+	}
+	return refs.sourceTables(from.TableRefs)
+}
+
+// checkTransactionalTables refuses a dry run that would change a table whose storage engine cannot
+// roll back, such as MyISAM or MEMORY, since its changes would persist. Views are refused as well,
+// as the engines of the tables below them are not known. Tables that do not exist are left to the statement
+func checkTransactionalTables(ctx context.Context, db sqlx.QueryerContext, tables []tableRef) error {
+	if len(tables) == 0 {
+		return nil
+	}
+
+	conditions := make([]string, len(tables))
+	args := make([]interface{}, 0, 2*len(tables))
+	for i, table := range tables {
+		conditions[i] = "(t.TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND t.TABLE_NAME = ?)"
+		args = append(args, table.db, table.table)
+	}
+	rows, err := db.QueryxContext(ctx, `SELECT t.TABLE_SCHEMA, t.TABLE_NAME, t.TABLE_TYPE, COALESCE(t.ENGINE, '')
+		FROM information_schema.TABLES t LEFT JOIN information_schema.ENGINES e ON e.ENGINE = t.ENGINE
+		WHERE (`+strings.Join(conditions, " OR ")+`) AND COALESCE(e.TRANSACTIONS, 'NO') <> 'YES'
+		ORDER BY t.TABLE_SCHEMA, t.TABLE_NAME`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to look up the storage engines of the changed tables: %v", err)
+	}
+	defer rows.Close()
+
+	refused := []string{}
+	for rows.Next() {
+		var table tableRef
+		var tableType, engine string
+		if err := rows.Scan(&table.db, &table.table, &tableType, &engine); err != nil {
+			return err
+		}
+		if engine == "" {
+			refused = append(refused, fmt.Sprintf("%s (%s)", table, strings.ToLower(tableType)))
+		} else {
+			refused = append(refused, fmt.Sprintf("%s (%s)", table, engine))
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(refused) > 0 {
+		return fmt.Errorf("dry_run is not possible, the statement changes tables whose storage engine cannot roll back: %s",
+			strings.Join(refused, ", "))
+	}
+	return nil
+}
+
+// rollbackToSavepoint undoes the statements since writeSavepoint. If that fails the whole transaction
+// is rolled back, as it would otherwise commit changes that were meant to be undone. The caller must hold t.mu
+func (t *Transaction) rollbackToSavepoint(ctx context.Context) error {
+	if _, err := t.tx.ExecContext(t.session.ctx, "ROLLBACK TO SAVEPOINT "+writeSavepoint); err != nil {
+		t.end(false)
+		t.store.remove(t.ID)
+		return fmt.Errorf("failed to undo the statement: %v, transaction %s was rolled back", statementError(ctx, err), t.ID)
+	}
+	return nil
+}
+
+// dryRunReport is what a dry run observed before it was rolled back
+type dryRunReport struct {
+	summary string
+	// before and after are the sampled rows, nil when the statement was not sampled
+	before *QueryResult
+	after  *QueryResult
+	// sameRows is set when after holds the rows of before looked up by primary key
+	sameRows bool
+	// refused explains why the statement would not run without dry_run
+	refused string
+	note    string
+}
+
+func (r *dryRunReport) render(opts QueryOptions) (string, error) {
+	formatter, err := GetFormatter(opts.Format, FormatOptions{NullValue: opts.NullValue})
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run, the statement was rolled back: %s\n", r.summary)
+	if r.refused != "" {
+		fmt.Fprintf(&b, "%s\n", r.refused)
+	}
+	if r.note != "" {
+		fmt.Fprintf(&b, "%s\n", r.note)
+	}
+
+	afterLabel := "Matched rows after the statement"
+	if r.sameRows {
+		afterLabel = "The same rows after the statement"
+	}
+	for _, sample := range []struct {
+		label  string
+		result *QueryResult
+	}{
+		{"Matched rows before the statement", r.before},
+		{afterLabel, r.after},
+	} {
+		if sample.result == nil {
+			continue
+		}
+		text, err := formatter.Format(sample.result.ColumnNames(), sample.result.Rows)
+		if err != nil {
+			return "", err
+		}
+		if sample.result.Truncated {
+			fmt.Fprintf(&b, "\n%s (first %d rows):\n%s", sample.label, len(sample.result.Rows), text)
+		} else {
+			fmt.Fprintf(&b, "\n%s (%d rows):\n%s", sample.label, len(sample.result.Rows), text)
+		}
+	}
+	return b.String(), nil
+}
+
+// matchPlan selects the rows a single-table UPDATE or DELETE matches
+type matchPlan struct {
+	// query selects the matched rows
+	query string
+	args  []interface{}
+	// from is the statement's table reference as SQL, with its alias
+	from string
+	// clauses are the WHERE, ORDER BY and LIMIT clauses of query
+	clauses string
+	schema  string
+	table   string
+}
+
+// newMatchPlan builds a SELECT with the WHERE, ORDER BY and LIMIT clauses of the statement and the
+// args of their ? markers. Without a LIMIT clause it reads at most rowLimit rows. It returns nil
+// for statements other than single-table UPDATE and DELETE
+func newMatchPlan(stmt *Statement, args []interface{}, rowLimit int) (*matchPlan, error) {
+	var refs *ast.TableRefsClause
+	var where ast.ExprNode
+	var order *ast.OrderByClause
+	var limit *ast.Limit
+	switch n := stmt.Node.(type) {
+	case *ast.UpdateStmt:
+		if n.MultipleTable || n.With != nil {
+			return nil, nil
+		}
+		refs, where, order, limit = n.TableRefs, n.Where, n.Order, n.Limit
+	case *ast.DeleteStmt:
+		if n.IsMultiTable || n.With != nil {
+			return nil, nil
+		}
+		refs, where, order, limit = n.TableRefs, n.Where, n.Order, n.Limit
+	default:
+		return nil, nil
+	}
+
+	if refs == nil || refs.TableRefs == nil || refs.TableRefs.Right != nil {
+		return nil, nil
+	}
+	source, ok := refs.TableRefs.Left.(*ast.TableSource)
+	if !ok {
+		return nil, nil
+	}
+	name, ok := source.Source.(*ast.TableName)
+	if !ok {
+		return nil, nil
+	}
+
+	var from strings.Builder
+	if err := source.Restore(format.NewRestoreCtx(restoreFlags, &from)); err != nil {
+		return nil, fmt.Errorf("failed to build sample query: %v", err)
+	}
+
+	var b strings.Builder
+	ctx := format.NewRestoreCtx(restoreFlags, &b)
+	var clauses []ast.Node
+	if where != nil {
+		b.WriteString(" WHERE ")
+		if err := where.Restore(ctx); err != nil {
+			return nil, fmt.Errorf("failed to build sample query: %v", err)
+		}
+		clauses = append(clauses, where)
+	}
+	if order != nil {
+		b.WriteString(" ")
+		if err := order.Restore(ctx); err != nil {
+			return nil, fmt.Errorf("failed to build sample query: %v", err)
+		}
+		clauses = append(clauses, order)
+	}
+	if limit != nil {
+		b.WriteString(" ")
+		if err := limit.Restore(ctx); err != nil {
+			return nil, fmt.Errorf("failed to build sample query: %v", err)
+		}
+		clauses = append(clauses, limit)
+	} else {
+		fmt.Fprintf(&b, " LIMIT %d", rowLimit)
+	}
+
+	sampleArgs, err := markerArgs(stmt.Node, clauses, args)
+	if err != nil {
+		return nil, err
+	}
+
+	return &matchPlan{
+		query:   "SELECT * FROM " + from.String() + b.String(),
+		args:    sampleArgs,
+		from:    from.String(),
+		clauses: b.String(),
+		schema:  name.Schema.O,
+		table:   name.Name.O,
+	}, nil
+}
+
+// markerArgs returns the args bound to the ? markers inside clauses, which are parts of stmt
+func markerArgs(stmt ast.Node, clauses []ast.Node, args []interface{}) ([]interface{}, error) {
+	all := paramMarkerOffsets(stmt)
+	if len(all) == 0 {
+		return nil, nil
+	}
+	if len(all) != len(args) {
+		return nil, fmt.Errorf("the statement has %d ? markers but %d params were given", len(all), len(args))
+	}
+
+	index := make(map[int]int, len(all))
+	for i, offset := range all {
+		index[offset] = i
+	}
+
+	var selected []interface{}
+	for _, clause := range clauses {
+		for _, offset := range paramMarkerOffsets(clause) {
+			selected = append(selected, args[index[offset]])
+		}
+	}
+	return selected, nil
+}
+
+// paramMarkerOffsets returns the positions of the ? markers in node in the order they appear in the SQL
+func paramMarkerOffsets(node ast.Node) []int {
+	finder := &paramMarkerFinder{}
+	node.Accept(finder)
+	sort.Ints(finder.offsets)
+	return finder.offsets
+}
+
+type paramMarkerFinder struct {
+	offsets []int
+}
+
+func (f *paramMarkerFinder) Enter(n ast.Node) (ast.Node, bool) {
+	if marker, ok := n.(*test_driver.ParamMarkerExpr); ok {
+		f.offsets = append(f.offsets, marker.Offset)
+	}
+	return n, false
+}
+
+func (f *paramMarkerFinder) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// sampleRows reads up to opts.SampleRows rows of query. It also returns the raw values of the rows,
+// which bind back to the same column values
+func sampleRows(ctx context.Context, db sqlx.QueryerContext, query string, args []interface{}, opts WriteOptions, conn *Connection) (*QueryResult, [][]interface{}, error) {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	scanner, err := newRowScanner(rows, opts.Query.valueConverter())
+	if err != nil {
+		return nil, nil, err
+	}
+	scanner.applyMasking(conn.Masker, query)
+
+	result := &QueryResult{Columns: scanner.columns, Rows: []map[string]interface{}{}, MaxRows: opts.SampleRows, connection: conn.Name}
+	raw := [][]interface{}{}
+	for rows.Next() {
+		if len(result.Rows) >= opts.SampleRows {
+			result.Truncated = true
+			break
+		}
+		row, err := rows.SliceScan()
+		if err != nil {
+			return nil, nil, err
+		}
+		converted, err := scanner.convert(row)
+		if err != nil {
+			return nil, nil, err
+		}
+		result.Rows = append(result.Rows, converted)
+		raw = append(raw, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return result, raw, nil
+}
+
+// primaryKey returns the primary key columns of a table in key order. An empty schema is the current database
+func primaryKey(ctx context.Context, db sqlx.QueryerContext, schema, table string) ([]string, error) {
+	rows, err := db.QueryxContext(ctx, `SELECT COLUMN_NAME FROM information_schema.KEY_COLUMN_USAGE
+		WHERE TABLE_SCHEMA = COALESCE(NULLIF(?, ''), DATABASE()) AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY'
+		ORDER BY ORDINAL_POSITION`, schema, table)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up the primary key of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	columns := []string{}
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return nil, err
+		}
+		columns = append(columns, column)
+	}
+	return columns, rows.Err()
+}
+
+// columnValues picks the values of the named columns from each raw row. It returns nil unless
+// every column is in the result
+func columnValues(columns []ColumnInfo, raw [][]interface{}, names []string) [][]interface{} {
+	if len(names) == 0 {
+		return nil
+	}
+
+	positions := make([]int, len(names))
+	for i, name := range names {
+		positions[i] = -1
+		for j, col := range columns {
+			if strings.EqualFold(col.Name, name) {
+				positions[i] = j
+				break
+			}
+		}
+		if positions[i] < 0 {
+			return nil
+		}
+	}
+
+	values := make([][]interface{}, len(raw))
+	for i, row := range raw {
+		values[i] = make([]interface{}, len(positions))
+		for j, pos := range positions {
+			values[i][j] = row[pos]
+		}
+	}
+	return values
+}
+
+// keyQuery selects the rows of from whose key columns have one of the given value tuples
+func keyQuery(from string, columns []string, values [][]interface{}) (string, []interface{}) {
+	quoted := make([]string, len(columns))
+	for i, col := range columns {
+		quoted[i] = quoteIdentifier(col)
+	}
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+
+	tuples := make([]string, len(values))
+	args := make([]interface{}, 0, len(values)*len(columns))
+	for i, row := range values {
+		tuples[i] = tuple
+		args = append(args, row...)
+	}
+
+	return fmt.Sprintf("SELECT * FROM %s WHERE (%s) IN (%s)", from, strings.Join(quoted, ", "), strings.Join(tuples, ", ")), args
+}
+
+// quoteIdentifier quotes a MySQL identifier with backticks
+func quoteIdentifier(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
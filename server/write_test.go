@@ -0,0 +1,210 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/cnosuke/mcp-mysql/config"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewWriteOptions(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Write.DryRun = true
+	cfg.Write.DryRunSampleRows = 5
+	cfg.Write.RequireWhere = true
+	cfg.Write.MaxAffectedRows = 100
+
+	newRequest := func(args map[string]any) mcp.CallToolRequest {
+		request := mcp.CallToolRequest{}
+		request.Params.Arguments = args
+		return request
+	}
+
+	t.Run("defaults from config", func(t *testing.T) {
+		opts := NewWriteOptions(cfg, newRequest(nil))
+		assert.True(t, opts.DryRun)
+		assert.Equal(t, 5, opts.SampleRows)
+		assert.True(t, opts.RequireWhere)
+		assert.Equal(t, 100, opts.MaxAffectedRows)
+	})
+
+	t.Run("per-call values", func(t *testing.T) {
+		opts := NewWriteOptions(cfg, newRequest(map[string]any{"dry_run": false, "max_affected_rows": float64(10)}))
+		assert.False(t, opts.DryRun)
+		assert.Equal(t, 10, opts.MaxAffectedRows)
+	})
+
+	t.Run("max_affected_rows cannot be raised", func(t *testing.T) {
+		opts := NewWriteOptions(cfg, newRequest(map[string]any{"max_affected_rows": float64(1000)}))
+		assert.Equal(t, 100, opts.MaxAffectedRows)
+	})
+}
+
+func TestAffectedRowsLimit(t *testing.T) {
+	parse := func(query string) *Statement {
+		stmt, err := ParseStatement(query)
+		assert.NoError(t, err)
+		return stmt
+	}
+	opts := WriteOptions{MaxAffectedRows: 10}
+
+	assert.Equal(t, int64(10), opts.affectedRowsLimit(parse("UPDATE t SET a = 1 WHERE id = 1")))
+	assert.Equal(t, int64(10), opts.affectedRowsLimit(parse("DELETE FROM t WHERE id = 1")))
+	assert.Equal(t, int64(0), opts.affectedRowsLimit(parse("INSERT INTO t VALUES (1)")))
+	assert.Equal(t, int64(0), opts.affectedRowsLimit(nil))
+	assert.Equal(t, int64(0), WriteOptions{}.affectedRowsLimit(parse("DELETE FROM t WHERE id = 1")))
+}
+
+func TestCheckWrite(t *testing.T) {
+	_, err := checkWrite("DELETE FROM t", WriteOptions{RequireWhere: true})
+	assert.ErrorContains(t, err, "without a WHERE clause")
+
+	stmt, err := checkWrite("DELETE FROM t", WriteOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, StatementTypeDelete, stmt.Kind)
+}
+
+func TestCheckAffectedRows(t *testing.T) {
+	stmt := &Statement{Kind: StatementTypeDelete}
+	assert.NoError(t, checkAffectedRows(stmt, fixedResult(10), 10))
+	assert.ErrorContains(t, checkAffectedRows(stmt, fixedResult(11), 10), "DELETE changed 11 rows, more than 10 (max_affected_rows), and was rolled back")
+}
+
+// fixedResult is a sql.Result with a fixed number of affected rows
+type fixedResult int64
+
+func (r fixedResult) LastInsertId() (int64, error) { return 0, nil }
+func (r fixedResult) RowsAffected() (int64, error) { return int64(r), nil }
+
+func TestNewMatchPlan(t *testing.T) {
+	plan := func(t *testing.T, query string, args ...interface{}) *matchPlan {
+		stmt, err := ParseStatement(query)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		p, err := newMatchPlan(stmt, args, 11)
+		assert.NoError(t, err)
+		return p
+	}
+
+	t.Run("update keeps where, order and limit", func(t *testing.T) {
+		p := plan(t, "UPDATE users SET name = 'x' WHERE age > 30 AND name <> 'x' ORDER BY id LIMIT 5")
+		if assert.NotNil(t, p) {
+			assert.Equal(t, "SELECT * FROM `users` WHERE `age`>30 AND `name`!='x' ORDER BY `id` LIMIT 5", p.query)
+			assert.Equal(t, " WHERE `age`>30 AND `name`!='x' ORDER BY `id` LIMIT 5", p.clauses)
+			assert.Equal(t, "`users`", p.from)
+			assert.Equal(t, "", p.schema)
+			assert.Equal(t, "users", p.table)
+		}
+	})
+
+	t.Run("delete with schema and alias", func(t *testing.T) {
+		p := plan(t, "DELETE FROM app.users AS u WHERE u.id = 1")
+		if assert.NotNil(t, p) {
+			assert.Equal(t, "SELECT * FROM `app`.`users` AS `u` WHERE `u`.`id`=1 LIMIT 11", p.query)
+			assert.Equal(t, "app", p.schema)
+			assert.Equal(t, "users", p.table)
+		}
+	})
+
+	t.Run("only the where params are kept", func(t *testing.T) {
+		p := plan(t, "UPDATE users SET name = ?, age = ? WHERE id = ? AND status = ?", "x", 1, 42, "active")
+		if assert.NotNil(t, p) {
+			assert.Equal(t, "SELECT * FROM `users` WHERE `id`=? AND `status`=? LIMIT 11", p.query)
+			assert.Equal(t, []interface{}{42, "active"}, p.args)
+		}
+	})
+
+	t.Run("param count mismatch", func(t *testing.T) {
+		stmt, err := ParseStatement("DELETE FROM users WHERE id = ?")
+		assert.NoError(t, err)
+		_, err = newMatchPlan(stmt, nil, 11)
+		assert.Error(t, err)
+	})
+
+	t.Run("statements that are not sampled", func(t *testing.T) {
+		assert.Nil(t, plan(t, "INSERT INTO users (name) VALUES ('x')"))
+		assert.Nil(t, plan(t, "UPDATE users u JOIN orders o ON o.user_id = u.id SET u.name = 'x'"))
+		assert.Nil(t, plan(t, "DELETE u FROM users u JOIN orders o ON o.user_id = u.id"))
+	})
+}
+
+func TestKeyQuery(t *testing.T) {
+	query, args := keyQuery("`users` AS `u`", []string{"tenant", "id"}, [][]interface{}{{1, 2}, {1, 3}})
+	assert.Equal(t, "SELECT * FROM `users` AS `u` WHERE (`tenant`, `id`) IN ((?, ?), (?, ?))", query)
+	assert.Equal(t, []interface{}{1, 2, 1, 3}, args)
+}
+
+func TestColumnValues(t *testing.T) {
+	columns := []ColumnInfo{{Name: "ID"}, {Name: "name"}}
+	raw := [][]interface{}{{[]byte("1"), []byte("alice")}, {[]byte("2"), nil}}
+
+	t.Run("key columns", func(t *testing.T) {
+		assert.Equal(t, [][]interface{}{{[]byte("1")}, {[]byte("2")}}, columnValues(columns, raw, []string{"id"}))
+	})
+
+	t.Run("missing column", func(t *testing.T) {
+		assert.Nil(t, columnValues(columns, raw, []string{"id", "tenant"}))
+	})
+
+	t.Run("no key", func(t *testing.T) {
+		assert.Nil(t, columnValues(columns, raw, nil))
+	})
+}
+
+func TestDryRunReport(t *testing.T) {
+	columns := []ColumnInfo{{Name: "id"}, {Name: "name"}}
+	report := &dryRunReport{
+		summary:  "1 rows affected",
+		before:   &QueryResult{Columns: columns, Rows: []map[string]interface{}{{"id": 1, "name": "alice"}}},
+		after:    &QueryResult{Columns: columns, Rows: []map[string]interface{}{{"id": 1, "name": nil}}},
+		sameRows: true,
+	}
+
+	text, err := report.render(QueryOptions{Format: FormatCSV, NullValue: "NULL"})
+	assert.NoError(t, err)
+	assert.Equal(t, "Dry run, the statement was rolled back: 1 rows affected\n"+
+		"\nMatched rows before the statement (1 rows):\nid,name\n1,alice\n"+
+		"\nThe same rows after the statement (1 rows):\nid,name\n1,NULL\n", text)
+
+	t.Run("truncated sample", func(t *testing.T) {
+		report := &dryRunReport{
+			summary: "3 rows affected",
+			before:  &QueryResult{Columns: columns, Rows: []map[string]interface{}{{"id": 1, "name": "alice"}}, Truncated: true},
+			after:   &QueryResult{Columns: columns, Rows: []map[string]interface{}{}},
+		}
+		text, err := report.render(QueryOptions{Format: FormatCSV})
+		assert.NoError(t, err)
+		assert.Contains(t, text, "Matched rows before the statement (first 1 rows):")
+		assert.Contains(t, text, "Matched rows after the statement (0 rows):\nid,name\n")
+	})
+}
+
+func TestDryRunTargets(t *testing.T) {
+	tests := []struct {
+		query  string
+		tables []tableRef
+	}{
+		{"INSERT INTO log (msg) SELECT name FROM archive.users", []tableRef{{"shop", "log"}}},
+		{"REPLACE INTO crm.contacts VALUES (1)", []tableRef{{"crm", "contacts"}}},
+		{"UPDATE orders o JOIN items i ON i.order_id = o.id SET i.qty = 0 WHERE o.id IN (SELECT id FROM old)",
+			[]tableRef{{"shop", "orders"}, {"shop", "items"}}},
+		{"DELETE FROM sessions WHERE expires < NOW()", []tableRef{{"shop", "sessions"}}},
+		{"WITH stale AS (SELECT 1 AS id) DELETE s FROM sessions s JOIN stale ON stale.id = s.id", []tableRef{{"shop", "sessions"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			stmt, err := ParseStatement(tt.query)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.tables, dryRunTargets(stmt, "shop"))
+		})
+	}
+}
+
+func TestQuoteIdentifier(t *testing.T) {
+	assert.Equal(t, "`users`", quoteIdentifier("users"))
+	assert.Equal(t, "`we``ird`", quoteIdentifier("we`ird"))
+}